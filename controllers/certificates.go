@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// aggregatorCASecret holds the CA the serving certificate of the aggregator is signed with
+	aggregatorCASecret = "logging-plumber-log-aggregator-ca"
+	// aggregatorTLSSecret holds the serving certificate of the aggregator, it's mounted into the aggregator pod
+	aggregatorTLSSecret = "logging-plumber-log-aggregator-tls"
+	// caBundleField holds the current CA along with the previous one, so outputs made before a rotation keep working
+	caBundleField = "ca-bundle.crt"
+
+	caValidity          = 365 * 24 * time.Hour
+	servingCertValidity = 30 * 24 * time.Hour
+)
+
+// aggregatorCertificates makes sure the CA and the serving certificate of the aggregator exist and aren't
+// about to expire, certificates are renewed once two thirds of their validity passed. It returns the CA bundle
+// the outputs verify the aggregator with.
+func (r *FlowTestReconciler) aggregatorCertificates(ctx context.Context) ([]byte, error) {
+	logger := log.FromContext(ctx)
+
+	var caSecret v1.Secret
+	err := r.Get(ctx, client.ObjectKey{Name: aggregatorCASecret, Namespace: r.AggregatorNamespace}, &caSecret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "failed to get the aggregator CA")
+		return nil, err
+	}
+	caExists := err == nil
+
+	caCert, caKey, err := parseKeyPair(caSecret.Data[v1.TLSCertKey], caSecret.Data[v1.TLSPrivateKeyKey])
+	if err != nil || renewalDue(caCert, caValidity) {
+		caCertPEM, caKeyPEM, err := newCertificate(nil, nil, "logging-plumber-log-aggregator-ca", nil, caValidity)
+		if err != nil {
+			return nil, err
+		}
+		// keep trusting the previous CA until the outputs made with it are gone
+		bundle := append(append([]byte{}, caCertPEM...), caSecret.Data[v1.TLSCertKey]...)
+		caSecret = r.certificateSecret(aggregatorCASecret, map[string][]byte{
+			v1.TLSCertKey:       caCertPEM,
+			v1.TLSPrivateKeyKey: caKeyPEM,
+			caBundleField:       bundle,
+		})
+		if err := r.saveCertificateSecret(ctx, &caSecret, caExists); err != nil {
+			return nil, err
+		}
+		logger.Info("rotated the aggregator CA")
+		if caCert, caKey, err = parseKeyPair(caCertPEM, caKeyPEM); err != nil {
+			return nil, err
+		}
+	}
+
+	var tlsSecret v1.Secret
+	err = r.Get(ctx, client.ObjectKey{Name: aggregatorTLSSecret, Namespace: r.AggregatorNamespace}, &tlsSecret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "failed to get the aggregator serving certificate")
+		return nil, err
+	}
+	tlsExists := err == nil
+
+	servingCert, _, err := parseKeyPair(tlsSecret.Data[v1.TLSCertKey], tlsSecret.Data[v1.TLSPrivateKeyKey])
+	if err != nil || renewalDue(servingCert, servingCertValidity) || servingCert.CheckSignatureFrom(caCert) != nil {
+		// outputs of the running tests only trust the CA in their ingestion secrets, they get the new bundle
+		// before the aggregator serves a certificate signed with the new CA
+		if err := r.updateIngestionSecrets(ctx, caSecret.Data[caBundleField]); err != nil {
+			return nil, err
+		}
+		service := "logging-plumber-log-aggregator"
+		dnsNames := []string{
+			service,
+			fmt.Sprintf("%s.%s", service, r.AggregatorNamespace),
+			fmt.Sprintf("%s.%s.svc", service, r.AggregatorNamespace),
+			fmt.Sprintf("%s.%s.svc.cluster.local", service, r.AggregatorNamespace),
+		}
+		certPEM, keyPEM, err := newCertificate(caCert, caKey, service, dnsNames, servingCertValidity)
+		if err != nil {
+			return nil, err
+		}
+		tlsSecret = r.certificateSecret(aggregatorTLSSecret, map[string][]byte{
+			v1.TLSCertKey:       certPEM,
+			v1.TLSPrivateKeyKey: keyPEM,
+		})
+		tlsSecret.Type = v1.SecretTypeTLS
+		if err := r.saveCertificateSecret(ctx, &tlsSecret, tlsExists); err != nil {
+			return nil, err
+		}
+		logger.Info("rotated the aggregator serving certificate")
+	}
+
+	return caSecret.Data[caBundleField], nil
+}
+
+// certificateSecret keeps the certificates out of the cleanup of the aggregator, they outlive it
+func (r *FlowTestReconciler) certificateSecret(name string, data map[string][]byte) v1.Secret {
+	return v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "V1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.AggregatorNamespace,
+			Labels: GetLabels("logging-plumber-log-aggregator", nil,
+				map[string]string{"loggingpipelineplumber.isala.me/component": "log-aggregator-certificates"}),
+		},
+		Data: data,
+	}
+}
+
+func (r *FlowTestReconciler) saveCertificateSecret(ctx context.Context, secret *v1.Secret, exists bool) error {
+	logger := log.FromContext(ctx)
+	var err error
+	if exists {
+		err = r.Update(ctx, secret)
+	} else {
+		err = r.Create(ctx, secret)
+	}
+	if err != nil {
+		logger.Error(err, "failed to save the aggregator certificates", "secret", secret.ObjectMeta.Name)
+	}
+	return err
+}
+
+// renewalDue tells whether two thirds of the validity of the certificate passed
+func renewalDue(cert *x509.Certificate, validity time.Duration) bool {
+	return time.Now().After(cert.NotAfter.Add(-validity / 3))
+}
+
+// newCertificate creates a key pair in PEM, it's a self signed CA when there is no parent
+func newCertificate(parent *x509.Certificate, parentKey *ecdsa.PrivateKey, commonName string, dnsNames []string, validity time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var certPEM, keyPEM bytes.Buffer
+	if err := pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		return nil, nil, err
+	}
+	if err := pem.Encode(&keyPEM, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}); err != nil {
+		return nil, nil, err
+	}
+	return certPEM.Bytes(), keyPEM.Bytes(), nil
+}
+
+func parseKeyPair(certPEM []byte, keyPEM []byte) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("missing certificate or key")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAggregatorCertificatesRotation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// caValidity of the existing CA, it's due for renewal when it's short
+		caValidity time.Duration
+		rotated    bool
+	}{
+		{name: "certificates in date", caValidity: caValidity},
+		{name: "CA due for renewal", caValidity: time.Hour, rotated: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			caCertPEM, caKeyPEM, err := newCertificate(nil, nil, "old-ca", nil, tc.caValidity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			caCert, caKey, err := parseKeyPair(caCertPEM, caKeyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			certPEM, keyPEM, err := newCertificate(caCert, caKey, "logging-plumber-log-aggregator", nil, servingCertValidity)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := &FlowTestReconciler{AggregatorNamespace: "plumber"}
+			caSecret := r.certificateSecret(aggregatorCASecret, map[string][]byte{
+				v1.TLSCertKey:       caCertPEM,
+				v1.TLSPrivateKeyKey: caKeyPEM,
+				caBundleField:       caCertPEM,
+			})
+			tlsSecret := r.certificateSecret(aggregatorTLSSecret, map[string][]byte{
+				v1.TLSCertKey:       certPEM,
+				v1.TLSPrivateKeyKey: keyPEM,
+			})
+			ingestionSecret := v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "uid-ingestion",
+					Namespace: "apps",
+					Labels:    GetLabels("log-aggregator-ingestion", nil),
+				},
+				Data: map[string][]byte{"ca.crt": caCertPEM},
+			}
+			kubeClient := fakeclient.NewClientBuilder().
+				WithScheme(testScheme(t)).
+				WithObjects(&caSecret, &tlsSecret, &ingestionSecret).
+				Build()
+			r.Client = kubeClient
+
+			ctx := context.Background()
+			bundle, err := r.aggregatorCertificates(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rotated := !bytes.Equal(bundle, caCertPEM); rotated != tc.rotated {
+				t.Errorf("expected the CA to be rotated %v, got %v", tc.rotated, rotated)
+			}
+
+			var gotIngestion, gotTLS v1.Secret
+			if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "apps", Name: "uid-ingestion"}, &gotIngestion); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(gotIngestion.Data["ca.crt"], bundle) {
+				t.Errorf("expected the ingestion secret to hold the CA bundle %s, got %s", bundle, gotIngestion.Data["ca.crt"])
+			}
+			if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "plumber", Name: aggregatorTLSSecret}, &gotTLS); err != nil {
+				t.Fatal(err)
+			}
+
+			// the outputs of the running test verify the serving certificate with their ingestion secret
+			servingCert, _, err := parseKeyPair(gotTLS.Data[v1.TLSCertKey], gotTLS.Data[v1.TLSPrivateKeyKey])
+			if err != nil {
+				t.Fatal(err)
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(gotIngestion.Data["ca.crt"]) {
+				t.Fatal("expected certificates in the ingestion secret")
+			}
+			if _, err := servingCert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err != nil {
+				t.Errorf("expected the serving certificate to be trusted by the ingestion secret: %s", err)
+			}
+			// the previous CA stays trusted for the outputs that weren't updated yet
+			if !bytes.Contains(gotIngestion.Data["ca.crt"], caCertPEM) {
+				t.Error("expected the previous CA to stay in the bundle")
+			}
+		})
+	}
+}
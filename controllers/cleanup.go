@@ -5,7 +5,9 @@ import (
 	"fmt"
 	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
 	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -44,6 +46,20 @@ func (r *FlowTestReconciler) cleanUpResources(ctx context.Context, flowTestName
 		logger.V(1).Info(fmt.Sprintf("%s deleted", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
 	}
 
+	var secretList v1.SecretList
+	if err := r.List(ctx, &secretList, matchingLabels); client.IgnoreNotFound(err) != nil {
+		logger.Error(err, fmt.Sprintf("failed to get provisioned %s", secretList.Kind))
+		return err
+	}
+
+	for _, resource := range secretList.Items {
+		if err := r.Delete(ctx, &resource); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, fmt.Sprintf("failed to delete a provisioned %s", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
+			return err
+		}
+		logger.V(1).Info(fmt.Sprintf("%s deleted", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
+	}
+
 	var flows flowv1beta1.FlowList
 	if err := r.List(ctx, &flows, &client.MatchingLabels{"loggingpipelineplumber.isala.me/flowtest": flowTestName}); client.IgnoreNotFound(err) != nil {
 		logger.Error(err, fmt.Sprintf("failed to get provisioned %s", flows.Kind))
@@ -121,6 +137,20 @@ func (r *FlowTestReconciler) cleanUpOutputResources(ctx context.Context) error {
 	logger.V(1).Info("no running flowtest found, cleaning up log-aggregator")
 
 	matchingLabels := &client.MatchingLabels{"loggingpipelineplumber.isala.me/component": "log-aggregator"}
+	var deploymentList appsv1.DeploymentList
+	if err := r.List(ctx, &deploymentList, matchingLabels); client.IgnoreNotFound(err) != nil {
+		logger.Error(err, fmt.Sprintf("failed to get provisioned %s", deploymentList.Kind))
+		return err
+	}
+
+	for _, resource := range deploymentList.Items {
+		if err := r.Delete(ctx, &resource); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, fmt.Sprintf("failed to delete a provisioned %s", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
+			return err
+		}
+		logger.V(1).Info(fmt.Sprintf("%s deleted", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
+	}
+
 	var podList v1.PodList
 	if err := r.List(ctx, &podList, matchingLabels); client.IgnoreNotFound(err) != nil {
 		logger.Error(err, fmt.Sprintf("failed to get provisioned %s", podList.Kind))
@@ -149,6 +179,50 @@ func (r *FlowTestReconciler) cleanUpOutputResources(ctx context.Context) error {
 		logger.V(1).Info(fmt.Sprintf("%s deleted", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
 	}
 
+	// the results are in the status of every finished flowtest, the records aren't needed anymore
+	var claimList v1.PersistentVolumeClaimList
+	if err := r.List(ctx, &claimList, matchingLabels); client.IgnoreNotFound(err) != nil {
+		logger.Error(err, fmt.Sprintf("failed to get provisioned %s", claimList.Kind))
+		return err
+	}
+
+	for _, resource := range claimList.Items {
+		if err := r.Delete(ctx, &resource); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, fmt.Sprintf("failed to delete a provisioned %s", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
+			return err
+		}
+		logger.V(1).Info(fmt.Sprintf("%s deleted", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
+	}
+
+	// a new key is minted along with the next aggregator
+	var secretList v1.SecretList
+	if err := r.List(ctx, &secretList, matchingLabels); client.IgnoreNotFound(err) != nil {
+		logger.Error(err, fmt.Sprintf("failed to get provisioned %s", secretList.Kind))
+		return err
+	}
+
+	for _, resource := range secretList.Items {
+		if err := r.Delete(ctx, &resource); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, fmt.Sprintf("failed to delete a provisioned %s", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
+			return err
+		}
+		logger.V(1).Info(fmt.Sprintf("%s deleted", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
+	}
+
+	var networkPolicyList networkingv1.NetworkPolicyList
+	if err := r.List(ctx, &networkPolicyList, matchingLabels); client.IgnoreNotFound(err) != nil {
+		logger.Error(err, fmt.Sprintf("failed to get provisioned %s", networkPolicyList.Kind))
+		return err
+	}
+
+	for _, resource := range networkPolicyList.Items {
+		if err := r.Delete(ctx, &resource); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, fmt.Sprintf("failed to delete a provisioned %s", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
+			return err
+		}
+		logger.V(1).Info(fmt.Sprintf("%s deleted", resource.Kind), "uuid", resource.GetUID(), "name", resource.GetName())
+	}
+
 	return nil
 }
 
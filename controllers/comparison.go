@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	filters "github.com/banzaicloud/logging-operator/pkg/sdk/model/filter"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// comparing tells whether the slices of the target take part in the comparison of the baseline and the candidate
+func comparing(flowTest *loggingpipelineplumberv1beta1.FlowTest, target referenceTarget) bool {
+	if flowTest.Spec.Comparison == nil || flowTest.Status.Comparison == nil {
+		return false
+	}
+	return target.key == primaryReference || target.key == candidateReference
+}
+
+// comparisonSettleWindow is how long the candidate gets to deliver its messages once the baseline delivered all of them
+const comparisonSettleWindow = time.Minute
+
+// initMessageComparisons starts with none of the sent messages delivered by either flow
+func initMessageComparisons(flowTest *loggingpipelineplumberv1beta1.FlowTest) {
+	if flowTest.Status.Comparison == nil {
+		return
+	}
+	flowTest.Status.Comparison.Messages = make([]loggingpipelineplumberv1beta1.MessageComparison, len(flowTest.Spec.SentMessages))
+	for i, message := range flowTest.Spec.SentMessages {
+		flowTest.Status.Comparison.Messages[i].Message = message.String()
+	}
+}
+
+// messageGuard only lets the sent message with the given index through, it runs before any
+// of the reference filters so the raw log line is still there. Every line of a multi-line message
+// gets through, so filters concatenating them still see the whole block.
+func messageGuard(flowTest *loggingpipelineplumberv1beta1.FlowTest, i int) flowv1beta1.Filter {
+	lines := flowTest.Spec.SentMessages[i].Lines()
+	for l, line := range lines {
+		lines[l] = regexp.QuoteMeta(line)
+	}
+	return flowv1beta1.Filter{
+		Grep: &filters.GrepConfig{
+			Regexp: []filters.RegexpSection{{
+				Key:     flowTest.Spec.Comparison.MessageKey,
+				Pattern: fmt.Sprintf(`^(%s)\n?$`, strings.Join(lines, "|")),
+			}},
+		},
+	}
+}
+
+// setDeliveredMessage marks the message behind the given slice labels as delivered by the baseline or the candidate
+func setDeliveredMessage(comparison *loggingpipelineplumberv1beta1.ComparisonStatus, labels map[string]string) {
+	if comparison == nil {
+		return
+	}
+	i, err := strconv.Atoi(labels["loggingpipelineplumber.isala.me/test-id"])
+	if err != nil || i < 0 || i >= len(comparison.Messages) {
+		return
+	}
+	switch labels["loggingpipelineplumber.isala.me/reference-flow"] {
+	case primaryReference:
+		comparison.Messages[i].BaselineDelivered = true
+	case candidateReference:
+		comparison.Messages[i].CandidateDelivered = true
+	}
+}
+
+// compareMessages reports the messages the candidate delivers differently than the baseline, records are
+// compared once both message slices delivered and their sample is in the status
+func compareMessages(flowTest *loggingpipelineplumberv1beta1.FlowTest) {
+	comparison := flowTest.Status.Comparison
+	if comparison == nil {
+		return
+	}
+
+	samples := map[string][]string{}
+	for _, slice := range flowTest.Status.Slices {
+		samples[slice.Name] = slice.Sample
+	}
+	baseline := referenceTarget{key: primaryReference}
+	candidate := referenceTarget{key: candidateReference}
+
+	baselineDelivered := true
+	for _, message := range comparison.Messages {
+		baselineDelivered = baselineDelivered && message.BaselineDelivered
+	}
+	if baselineDelivered && comparison.BaselineDeliveredAt == nil {
+		now := metav1.Now()
+		comparison.BaselineDeliveredAt = &now
+	}
+
+	for i := range comparison.Messages {
+		message := &comparison.Messages[i]
+		message.DeliveryChanged = message.BaselineDelivered != message.CandidateDelivered
+		message.RecordChanged = nil
+		switch {
+		case message.BaselineDelivered && !message.CandidateDelivered:
+			message.Diff = "delivered by the baseline but not by the candidate"
+		case !message.BaselineDelivered && message.CandidateDelivered:
+			message.Diff = "delivered by the candidate but not by the baseline"
+		case message.BaselineDelivered && message.CandidateDelivered:
+			baselineSample := samples[baseline.sliceName(*flowTest, i, "message")]
+			candidateSample := samples[candidate.sliceName(*flowTest, i, "message")]
+			if len(baselineSample) == 0 || len(candidateSample) == 0 {
+				message.Diff = ""
+				continue
+			}
+			changed, diff := recordDiff(baselineSample[0], candidateSample[0])
+			message.RecordChanged = &changed
+			message.Diff = diff
+		default:
+			message.Diff = ""
+		}
+	}
+}
+
+// recordDiff compares the top level keys of two records, records that aren't JSON objects are compared as text
+func recordDiff(baseline string, candidate string) (bool, string) {
+	var baselineRecord, candidateRecord map[string]interface{}
+	if json.Unmarshal([]byte(baseline), &baselineRecord) != nil || json.Unmarshal([]byte(candidate), &candidateRecord) != nil {
+		if baseline == candidate {
+			return false, ""
+		}
+		return true, fmt.Sprintf("baseline: %s, candidate: %s", baseline, candidate)
+	}
+
+	keys := map[string]bool{}
+	for key := range baselineRecord {
+		keys[key] = true
+	}
+	for key := range candidateRecord {
+		keys[key] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	var diff []string
+	for _, key := range sortedKeys {
+		baselineValue, inBaseline := baselineRecord[key]
+		candidateValue, inCandidate := candidateRecord[key]
+		switch {
+		case !inCandidate:
+			diff = append(diff, fmt.Sprintf("-%s", key))
+		case !inBaseline:
+			diff = append(diff, fmt.Sprintf("+%s: %s", key, marshalValue(candidateValue)))
+		case !reflect.DeepEqual(baselineValue, candidateValue):
+			diff = append(diff, fmt.Sprintf("~%s: %s -> %s", key, marshalValue(baselineValue), marshalValue(candidateValue)))
+		}
+	}
+
+	return len(diff) > 0, strings.Join(diff, "\n")
+}
+
+func marshalValue(value interface{}) string {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(out)
+}
+
+// comparisonPassing holds the test back until the baseline delivered every message and the candidate either did
+// the same or had comparisonSettleWindow to catch up, the messages it didn't deliver by then are reported as a diff
+func comparisonPassing(comparison *loggingpipelineplumberv1beta1.ComparisonStatus, now time.Time) bool {
+	if comparison == nil {
+		return true
+	}
+	candidateDelivered := true
+	for _, message := range comparison.Messages {
+		if !message.BaselineDelivered {
+			return false
+		}
+		candidateDelivered = candidateDelivered && message.CandidateDelivered
+	}
+	if candidateDelivered && flowPassing(comparison.Candidate) {
+		return true
+	}
+	return comparison.BaselineDeliveredAt != nil && !now.Before(comparison.BaselineDeliveredAt.Add(comparisonSettleWindow))
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestComparisonPassing(t *testing.T) {
+	now := time.Now()
+	at := func(ago time.Duration) *metav1.Time {
+		t := metav1.NewTime(now.Add(-ago))
+		return &t
+	}
+	truth := true
+	message := func(baseline, candidate bool) loggingpipelineplumberv1beta1.MessageComparison {
+		return loggingpipelineplumberv1beta1.MessageComparison{BaselineDelivered: baseline, CandidateDelivered: candidate}
+	}
+
+	for _, tc := range []struct {
+		name       string
+		comparison *loggingpipelineplumberv1beta1.ComparisonStatus
+		want       bool
+	}{
+		{name: "not comparing", want: true},
+		{
+			name:       "baseline still delivering",
+			comparison: &loggingpipelineplumberv1beta1.ComparisonStatus{Messages: []loggingpipelineplumberv1beta1.MessageComparison{message(true, true), message(false, true)}},
+			want:       false,
+		},
+		{
+			name: "both delivered everything",
+			comparison: &loggingpipelineplumberv1beta1.ComparisonStatus{
+				Candidate:           loggingpipelineplumberv1beta1.FlowResults{PipelineStatus: &truth},
+				Messages:            []loggingpipelineplumberv1beta1.MessageComparison{message(true, true)},
+				BaselineDeliveredAt: at(0),
+			},
+			want: true,
+		},
+		{
+			name: "candidate settling",
+			comparison: &loggingpipelineplumberv1beta1.ComparisonStatus{
+				Messages:            []loggingpipelineplumberv1beta1.MessageComparison{message(true, true), message(true, false)},
+				BaselineDeliveredAt: at(comparisonSettleWindow / 2),
+			},
+			want: false,
+		},
+		{
+			name: "candidate dropped a message",
+			comparison: &loggingpipelineplumberv1beta1.ComparisonStatus{
+				Messages:            []loggingpipelineplumberv1beta1.MessageComparison{message(true, true), message(true, false)},
+				BaselineDeliveredAt: at(comparisonSettleWindow),
+			},
+			want: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := comparisonPassing(tc.comparison, now); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCompareMessagesReportsDroppedMessages(t *testing.T) {
+	flowTest := loggingpipelineplumberv1beta1.FlowTest{
+		ObjectMeta: metav1.ObjectMeta{UID: "uid"},
+		Status: loggingpipelineplumberv1beta1.FlowTestStatus{
+			Comparison: &loggingpipelineplumberv1beta1.ComparisonStatus{
+				Messages: []loggingpipelineplumberv1beta1.MessageComparison{{BaselineDelivered: true}},
+			},
+		},
+	}
+
+	compareMessages(&flowTest)
+
+	comparison := flowTest.Status.Comparison
+	if comparison.BaselineDeliveredAt == nil {
+		t.Error("expected the time the baseline delivered everything to be recorded")
+	}
+	if !comparison.Messages[0].DeliveryChanged || comparison.Messages[0].Diff == "" {
+		t.Errorf("expected the dropped message to be reported as a diff, got %+v", comparison.Messages[0])
+	}
+}
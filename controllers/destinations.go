@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// destinationHealth reads the real outputs referenced by the reference flow, slices are redirected to the
+// log aggregator so this is the only place where the health of the actual destinations shows up
+func (r *FlowTestReconciler) destinationHealth(ctx context.Context, namespace string, loggingRef string, clusterScoped bool, localRefs []string, globalRefs []string) ([]loggingpipelineplumberv1beta1.DestinationHealth, error) {
+	var health []loggingpipelineplumberv1beta1.DestinationHealth
+
+	for _, name := range localRefs {
+		destination := loggingpipelineplumberv1beta1.DestinationHealth{
+			ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Output", Name: name, Namespace: namespace},
+		}
+
+		var output flowv1beta1.Output
+		if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &output); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, err
+			}
+			var outputs flowv1beta1.OutputList
+			if err := r.List(ctx, &outputs); err != nil {
+				return nil, err
+			}
+			var elsewhere []string
+			for _, o := range outputs.Items {
+				if o.ObjectMeta.Name == name {
+					elsewhere = append(elsewhere, o.ObjectMeta.Namespace)
+				}
+			}
+			destination.Message = fmt.Sprintf("output %s does not exist in %s", name, namespace)
+			if len(elsewhere) > 0 {
+				destination.Message += fmt.Sprintf(", but exists in %s and flows can only refer outputs from their own namespace", strings.Join(elsewhere, ", "))
+			}
+		} else {
+			destination.Found = true
+			setOutputStatus(&destination, output.Status)
+			if output.Spec.LoggingRef != loggingRef {
+				destination.Message = fmt.Sprintf("output belongs to loggingRef %q while the flow belongs to %q", output.Spec.LoggingRef, loggingRef)
+			}
+		}
+
+		health = append(health, destination)
+	}
+
+	if len(globalRefs) == 0 {
+		return health, nil
+	}
+
+	logging, err := r.referenceLogging(ctx, loggingRef, namespace, clusterScoped)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range globalRefs {
+		destination := loggingpipelineplumberv1beta1.DestinationHealth{
+			ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "ClusterOutput", Name: name, Namespace: logging.Spec.ControlNamespace},
+		}
+
+		var output flowv1beta1.ClusterOutput
+		if err := r.Get(ctx, types.NamespacedName{Namespace: logging.Spec.ControlNamespace, Name: name}, &output); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, err
+			}
+			var outputs flowv1beta1.ClusterOutputList
+			if err := r.List(ctx, &outputs); err != nil {
+				return nil, err
+			}
+			var elsewhere []string
+			for _, o := range outputs.Items {
+				if o.ObjectMeta.Name == name {
+					elsewhere = append(elsewhere, o.ObjectMeta.Namespace)
+				}
+			}
+			destination.Message = fmt.Sprintf("cluster output %s does not exist in the control namespace %s", name, logging.Spec.ControlNamespace)
+			if len(elsewhere) > 0 {
+				destination.Message += fmt.Sprintf(", but exists in %s", strings.Join(elsewhere, ", "))
+			}
+		} else {
+			destination.Found = true
+			setOutputStatus(&destination, output.Status)
+			if !clusterScoped && len(output.Spec.EnabledNamespaces) > 0 && !contains(output.Spec.EnabledNamespaces, namespace) {
+				destination.Message = fmt.Sprintf("cluster output is not enabled for namespace %s", namespace)
+			}
+		}
+
+		health = append(health, destination)
+	}
+
+	return health, nil
+}
+
+func setOutputStatus(destination *loggingpipelineplumberv1beta1.DestinationHealth, status flowv1beta1.OutputStatus) {
+	destination.Active = status.Active
+	destination.Problems = status.Problems
+	destination.ProblemsCount = status.ProblemsCount
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDestinationHealth(t *testing.T) {
+	active := true
+	kubeClient := fakeclient.NewClientBuilder().
+		WithScheme(testScheme(t)).
+		WithObjects(
+			&flowv1beta1.Logging{
+				ObjectMeta: metav1.ObjectMeta{Name: "logging"},
+				Spec:       flowv1beta1.LoggingSpec{ControlNamespace: "logging"},
+			},
+			&flowv1beta1.Output{
+				ObjectMeta: metav1.ObjectMeta{Name: "elastic", Namespace: "apps"},
+				Status:     flowv1beta1.OutputStatus{Active: &active, Problems: []string{"slow"}, ProblemsCount: 1},
+			},
+			&flowv1beta1.Output{
+				ObjectMeta: metav1.ObjectMeta{Name: "other-logging", Namespace: "apps"},
+				Spec:       flowv1beta1.OutputSpec{LoggingRef: "other"},
+			},
+			&flowv1beta1.Output{ObjectMeta: metav1.ObjectMeta{Name: "loki", Namespace: "monitoring"}},
+			&flowv1beta1.ClusterOutput{ObjectMeta: metav1.ObjectMeta{Name: "s3", Namespace: "logging"}},
+			&flowv1beta1.ClusterOutput{
+				ObjectMeta: metav1.ObjectMeta{Name: "restricted", Namespace: "logging"},
+				Spec:       flowv1beta1.ClusterOutputSpec{EnabledNamespaces: []string{"monitoring"}},
+			},
+			&flowv1beta1.ClusterOutput{ObjectMeta: metav1.ObjectMeta{Name: "misplaced", Namespace: "apps"}},
+		).
+		Build()
+	r := &FlowTestReconciler{Client: kubeClient}
+
+	for _, tc := range []struct {
+		name          string
+		clusterScoped bool
+		localRef      string
+		globalRef     string
+		want          loggingpipelineplumberv1beta1.DestinationHealth
+	}{
+		{
+			name:     "healthy output",
+			localRef: "elastic",
+			want: loggingpipelineplumberv1beta1.DestinationHealth{
+				ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Output", Name: "elastic", Namespace: "apps"},
+				Found:           true, Active: &active, Problems: []string{"slow"}, ProblemsCount: 1,
+			},
+		},
+		{
+			name:     "output in another namespace",
+			localRef: "loki",
+			want: loggingpipelineplumberv1beta1.DestinationHealth{
+				ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Output", Name: "loki", Namespace: "apps"},
+				Message:         "output loki does not exist in apps, but exists in monitoring and flows can only refer outputs from their own namespace",
+			},
+		},
+		{
+			name:     "missing output",
+			localRef: "missing",
+			want: loggingpipelineplumberv1beta1.DestinationHealth{
+				ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Output", Name: "missing", Namespace: "apps"},
+				Message:         "output missing does not exist in apps",
+			},
+		},
+		{
+			name:     "output of another logging",
+			localRef: "other-logging",
+			want: loggingpipelineplumberv1beta1.DestinationHealth{
+				ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Output", Name: "other-logging", Namespace: "apps"},
+				Found:           true,
+				Message:         `output belongs to loggingRef "other" while the flow belongs to ""`,
+			},
+		},
+		{
+			name:      "cluster output",
+			globalRef: "s3",
+			want: loggingpipelineplumberv1beta1.DestinationHealth{
+				ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "ClusterOutput", Name: "s3", Namespace: "logging"},
+				Found:           true,
+			},
+		},
+		{
+			name:      "cluster output not enabled for the namespace",
+			globalRef: "restricted",
+			want: loggingpipelineplumberv1beta1.DestinationHealth{
+				ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "ClusterOutput", Name: "restricted", Namespace: "logging"},
+				Found:           true,
+				Message:         "cluster output is not enabled for namespace apps",
+			},
+		},
+		{
+			name:          "enabled namespaces don't apply to cluster flows",
+			clusterScoped: true,
+			globalRef:     "restricted",
+			want: loggingpipelineplumberv1beta1.DestinationHealth{
+				ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "ClusterOutput", Name: "restricted", Namespace: "logging"},
+				Found:           true,
+			},
+		},
+		{
+			name:      "cluster output outside the control namespace",
+			globalRef: "misplaced",
+			want: loggingpipelineplumberv1beta1.DestinationHealth{
+				ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "ClusterOutput", Name: "misplaced", Namespace: "logging"},
+				Message:         "cluster output misplaced does not exist in the control namespace logging, but exists in apps",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			namespace := "apps"
+			if tc.clusterScoped {
+				namespace = "logging"
+			}
+			var localRefs, globalRefs []string
+			if tc.localRef != "" {
+				localRefs = []string{tc.localRef}
+			}
+			if tc.globalRef != "" {
+				globalRefs = []string{tc.globalRef}
+			}
+
+			health, err := r.destinationHealth(context.Background(), namespace, "", tc.clusterScoped, localRefs, globalRefs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(health) != 1 {
+				t.Fatalf("expected the health of a single destination, got %+v", health)
+			}
+			if !reflect.DeepEqual(health[0], tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, health[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	"github.com/banzaicloud/logging-operator/pkg/sdk/model/filter"
+	"github.com/mrsupiri/logging-pipeline-plumber/pkg/aggregator"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// validateFaults makes sure every fault has what its mode needs
+func validateFaults(flowTest loggingpipelineplumberv1beta1.FlowTest) error {
+	for i, fault := range flowTest.Spec.Faults {
+		if fault.Mode == loggingpipelineplumberv1beta1.LatencyFault && (fault.Latency == nil || fault.Latency.Duration <= 0) {
+			return fmt.Errorf("spec.faults[%d]: Latency faults need a latency", i)
+		}
+		if fault.Duration != nil && fault.Duration.Duration <= 0 {
+			return fmt.Errorf("spec.faults[%d]: duration must be positive", i)
+		}
+	}
+	return nil
+}
+
+// faultApplies tells whether any of the faults of the flowtest is injected into the slices of the given type
+func faultApplies(flowTest loggingpipelineplumberv1beta1.FlowTest, testType string) bool {
+	for _, fault := range flowTest.Spec.Faults {
+		if faultSelects(fault, testType) {
+			return true
+		}
+	}
+	return false
+}
+
+func faultSelects(fault loggingpipelineplumberv1beta1.FaultSpec, testType string) bool {
+	if len(fault.SliceTypes) == 0 {
+		return true
+	}
+	for _, sliceType := range fault.SliceTypes {
+		if sliceType == testType {
+			return true
+		}
+	}
+	return false
+}
+
+// eventTimeFilter stamps the records with the time of their event, so the aggregator can tell a record fluentd
+// sent again apart from the same message logged again. It runs after every other filter of the slice.
+func eventTimeFilter() flowv1beta1.Filter {
+	return flowv1beta1.Filter{
+		RecordTransformer: &filter.RecordTransformer{
+			EnableRuby: true,
+			Records:    []filter.Record{{aggregator.EventTimeKey: "${time.to_r.to_s}"}},
+		},
+	}
+}
+
+// configureFaults tells the aggregator which faults to inject into the slices of the flowtest, the windows are
+// fixed to the creation of the flowtest so setting them again on every check doesn't move them
+func (r *FlowTestReconciler) configureFaults(ctx context.Context, flowTest loggingpipelineplumberv1beta1.FlowTest) error {
+	logger := log.FromContext(ctx)
+
+	if len(flowTest.Spec.Faults) == 0 {
+		return nil
+	}
+
+	matchingLabels := client.MatchingLabels{"loggingpipelineplumber.isala.me/flowtest": flowTest.ObjectMeta.Name}
+	sliceTypes := map[string]string{}
+
+	var flows flowv1beta1.FlowList
+	if err := r.List(ctx, &flows, matchingLabels); client.IgnoreNotFound(err) != nil {
+		logger.Error(err, fmt.Sprintf("failed to get provisioned %s", flows.Kind))
+		return err
+	}
+	for _, flow := range flows.Items {
+		sliceTypes[flow.ObjectMeta.Name] = flow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"]
+	}
+
+	var clusterFlows flowv1beta1.ClusterFlowList
+	if err := r.List(ctx, &clusterFlows, matchingLabels); client.IgnoreNotFound(err) != nil {
+		logger.Error(err, fmt.Sprintf("failed to get provisioned %s", clusterFlows.Kind))
+		return err
+	}
+	for _, flow := range clusterFlows.Items {
+		sliceTypes[flow.ObjectMeta.Name] = flow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"]
+	}
+
+	faults := make([]aggregator.Fault, 0, len(flowTest.Spec.Faults))
+	for _, spec := range flowTest.Spec.Faults {
+		fault := aggregator.Fault{
+			Mode:       aggregator.FaultMode(spec.Mode),
+			StatusCode: spec.StatusCode,
+			Start:      flowTest.ObjectMeta.CreationTimestamp.Time,
+		}
+		if spec.Latency != nil {
+			fault.Latency = spec.Latency.Duration
+		}
+		if spec.StartAfter != nil {
+			fault.Start = fault.Start.Add(spec.StartAfter.Duration)
+		}
+		if spec.Duration != nil {
+			fault.End = fault.Start.Add(spec.Duration.Duration)
+		}
+		for name, testType := range sliceTypes {
+			if faultSelects(spec, testType) {
+				fault.Indexes = append(fault.Indexes, name)
+			}
+		}
+		faults = append(faults, fault)
+	}
+
+	key, err := r.ingestionKey(ctx)
+	if err != nil {
+		return err
+	}
+	uid := string(flowTest.ObjectMeta.UID)
+	if err := r.Aggregator.SetFaults(ctx, uid, aggregator.ControlToken(key, uid), faults); err != nil {
+		logger.Error(err, "failed to configure the faults")
+		return err
+	}
+	return nil
+}
+
+// recordFaults reports how the slices under a fault coped with it
+func recordFaults(flowTest *loggingpipelineplumberv1beta1.FlowTest, indexes map[string]aggregator.Index) {
+	for i := range flowTest.Status.Slices {
+		slice := &flowTest.Status.Slices[i]
+		if !faultApplies(*flowTest, slice.Type) {
+			continue
+		}
+
+		index := indexes[slice.Name]
+		status := &loggingpipelineplumberv1beta1.SliceFaultStatus{
+			FaultedWrites:    index.Faulted,
+			DiscardedRecords: index.Discarded,
+			Arrived:          index.LogCount > 0,
+			DuplicateRecords: index.Duplicates,
+		}
+		if status.Arrived && !index.FirstAttempt.IsZero() {
+			status.Lateness = &metav1.Duration{Duration: index.FirstLog.Sub(index.FirstAttempt).Round(time.Millisecond)}
+		}
+		slice.Faults = status
+	}
+}
@@ -18,17 +18,24 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	"reflect"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"strconv"
 	"time"
 
 	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	"github.com/mrsupiri/logging-pipeline-plumber/pkg/aggregator"
 	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -41,18 +48,52 @@ import (
 type FlowTestReconciler struct {
 	AggregatorNamespace string
 	PodSimulatorImage   Image
-	LogOutputImage      Image
+	AggregatorImage     Image
+	AggregatorStorage   AggregatorStorage
+	// AggregatorCallbackURL is where the log aggregator notifies about slices receiving logs, empty disables it
+	AggregatorCallbackURL string
+	// Notifications queues the flowtests the log aggregator notified about
+	Notifications <-chan event.GenericEvent
+	// SimulatorPodTemplate is a partial PodTemplateSpec in JSON applied to every simulation pod
+	SimulatorPodTemplate []byte
+	// AnnotationDenylist holds the annotations of the reference pod that aren't copied to the simulation pod
+	AnnotationDenylist []string
 	client.Client
-	Scheme   *runtime.Scheme
-	Recorder record.EventRecorder
+	// KubeClient is used for the APIs controller-runtime client doesn't cover, like pod logs
+	KubeClient kubernetes.Interface
+	Scheme     *runtime.Scheme
+	Recorder   record.EventRecorder
+	// Aggregator reads the logs the slices shipped to the log aggregator
+	Aggregator AggregatorClient
+}
+
+// aggregatorRestartGrace is how long a timed out test waits for a restarting log aggregator before completing
+const aggregatorRestartGrace = 2 * time.Minute
+
+// errAggregatorUnavailable marks a check that couldn't reach the log aggregator, it's retried without failing the reconcile
+var errAggregatorUnavailable = errors.New("log aggregator is unavailable")
+
+// AggregatorClient is the part of the log aggregator API the reconciler depends on
+type AggregatorClient interface {
+	// Indexes returns every index the aggregator received logs on, keyed by name
+	Indexes(ctx context.Context) (map[string]aggregator.Index, error)
+	// Records returns a page of the records of the index, aggregator.ErrIndexNotFound when it received nothing
+	Records(ctx context.Context, name string, query aggregator.RecordQuery) (aggregator.RecordPage, error)
+	// SetFaults replaces the faults injected into the slices of a flowtest
+	SetFaults(ctx context.Context, testUID string, token string, faults []aggregator.Fault) error
 }
 
 //+kubebuilder:rbac:groups=logging.banzaicloud.io,resources=flows;clusterflows;outputs;clusteroutputs,verbs=get;watch;list;create;delete
+//+kubebuilder:rbac:groups=logging.banzaicloud.io,resources=loggings,verbs=get;watch;list
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;watch;list;create;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;watch;list;create;delete
 //+kubebuilder:rbac:groups=loggingpipelineplumber.isala.me,resources=flowtests,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=loggingpipelineplumber.isala.me,resources=flowtests/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=loggingpipelineplumber.isala.me,resources=flowtests/finalizers,verbs=update
-//+kubebuilder:rbac:groups="",resources=pods;services;configmaps;namespaces,verbs=get;watch;list;create;delete
+//+kubebuilder:rbac:groups="",resources=pods;services;configmaps;namespaces;persistentvolumeclaims,verbs=get;watch;list;create;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;watch;list;create;update;delete
 //+kubebuilder:rbac:groups="",resources=pods/log,verbs=get;list
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -131,9 +172,25 @@ func (r *FlowTestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{RequeueAfter: time.Minute}, nil
 
 	case loggingpipelineplumberv1beta1.Running:
+		// certificates can come due while the test runs
+		if _, err := r.aggregatorCertificates(ctx); err != nil {
+			r.Recorder.Event(&flowTest, v1.EventTypeWarning, EventReasonReconcile, fmt.Sprintf("failed to renew the aggregator certificates: %s", err.Error()))
+		}
 		fiveMinuteAfterCreation := flowTest.CreationTimestamp.Add(5 * time.Minute)
+		if time.Now().After(fiveMinuteAfterCreation) {
+			// the logs that arrived right before the timeout are collected along with the completion
+			err := r.checkForPassingFlowTest(ctx, true)
+			if err == nil {
+				return ctrl.Result{RequeueAfter: 1 * time.Second}, nil
+			}
+			if errors.Is(err, errAggregatorUnavailable) && time.Now().Before(fiveMinuteAfterCreation.Add(aggregatorRestartGrace)) {
+				r.Recorder.Event(&flowTest, v1.EventTypeWarning, EventReasonReconcile, "log aggregator is unavailable, waiting for it before completing the test")
+				return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+			}
+			r.Recorder.Event(&flowTest, v1.EventTypeWarning, EventReasonReconcile, fmt.Sprintf("completing without a final check of the log indexes: %s", err.Error()))
+		}
 		//        Timeout                            or    all test are passing
-		if time.Now().After(fiveMinuteAfterCreation) || allTestPassing(flowTest.Status) {
+		if time.Now().After(fiveMinuteAfterCreation) || allTestPassing(flowTest.Status, time.Now()) {
 			flowTest.Status.Status = loggingpipelineplumberv1beta1.Completed
 			if err := r.Status().Update(ctx, &flowTest); err != nil {
 				logger.Error(err, "failed to set status as completed")
@@ -143,7 +200,12 @@ func (r *FlowTestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}
 
 		logger.V(1).Info("checking log indexes")
-		err := r.checkForPassingFlowTest(ctx)
+		err := r.checkForPassingFlowTest(ctx, false)
+		if errors.Is(err, errAggregatorUnavailable) {
+			// the aggregator keeps the records on its data volume, the slices are checked again once it's back
+			r.Recorder.Event(&flowTest, v1.EventTypeWarning, EventReasonReconcile, "log aggregator is unavailable, checking again once it's back")
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		}
 		if err != nil {
 			r.Recorder.Event(&flowTest, v1.EventTypeWarning, EventReasonReconcile, fmt.Sprintf("error while checking log indexes: %s", err.Error()))
 		}
@@ -163,8 +225,13 @@ func (r *FlowTestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *FlowTestReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&loggingpipelineplumberv1beta1.FlowTest{}).
+		Watches(&source.Kind{Type: &flowv1beta1.Logging{}}, handler.EnqueueRequestsFromMapFunc(r.runningFlowTests))
+	if r.Notifications != nil {
+		builder = builder.Watches(&source.Channel{Source: r.Notifications}, &handler.EnqueueRequestForObject{})
+	}
+	return builder.
 		WithEventFilter(eventFilter()).
 		Complete(r)
 }
@@ -172,109 +239,251 @@ func (r *FlowTestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 func eventFilter() predicate.Predicate {
 	return predicate.Funcs{
 		UpdateFunc: func(e event.UpdateEvent) bool {
+			// config check results of a Logging only show up in its status
+			if _, ok := e.ObjectNew.(*flowv1beta1.Logging); ok {
+				return true
+			}
 			// Ignore updates to CDR status in which case metadata.Generation does not change
 			return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration()
 		},
 	}
 }
 
-func (r *FlowTestReconciler) checkForPassingFlowTest(ctx context.Context) error {
+// runningFlowTests maps a Logging to the running flowtests that are being processed by it
+func (r *FlowTestReconciler) runningFlowTests(object client.Object) []reconcile.Request {
+	var flowTests loggingpipelineplumberv1beta1.FlowTestList
+	if err := r.List(context.Background(), &flowTests); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, flowTest := range flowTests.Items {
+		if flowTest.Status.Status != loggingpipelineplumberv1beta1.Running {
+			continue
+		}
+		processed := flowTest.Status.Logging == object.GetName()
+		for _, referenceFlow := range flowTest.Status.ReferenceFlows {
+			processed = processed || referenceFlow.Logging == object.GetName()
+		}
+		if processed {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: flowTest.ObjectMeta.Namespace,
+				Name:      flowTest.ObjectMeta.Name,
+			}})
+		}
+	}
+	return requests
+}
+
+func (r *FlowTestReconciler) checkForPassingFlowTest(ctx context.Context, complete bool) error {
 	logger := log.FromContext(ctx)
 	flowTest := ctx.Value("flowTest").(loggingpipelineplumberv1beta1.FlowTest)
 
-	if flowTest.Spec.ReferenceFlow.Kind == "ClusterFlow" {
+	// a single fetch covers the slices of every reference flow
+	indexes, err := r.Aggregator.Indexes(ctx)
+	if err != nil {
+		logger.Error(err, "failed to fetch log indexes")
+		return fmt.Errorf("%w: %s", errAggregatorUnavailable, err)
+	}
+
+	// the aggregator only keeps the faults in memory, a restarted one gets them back here
+	if err := r.configureFaults(ctx, flowTest); err != nil {
+		r.Recorder.Event(&flowTest, v1.EventTypeWarning, EventReasonReconcile, fmt.Sprintf("failed to configure the faults: %s", err.Error()))
+	}
+
+	for _, target := range referenceTargets(&flowTest) {
+		if err := r.checkReferenceSlices(ctx, &flowTest, target, indexes); err != nil {
+			return err
+		}
+	}
+	compareMessages(&flowTest)
+	r.recordRejectedWrites(&flowTest, indexes)
+	recordTruncation(&flowTest, indexes)
+	recordFaults(&flowTest, indexes)
+	if complete {
+		flowTest.Status.Status = loggingpipelineplumberv1beta1.Completed
+	}
+	return r.Status().Update(ctx, &flowTest)
+}
+
+// checkReferenceSlices collects the results of the slices of a single reference flow
+func (r *FlowTestReconciler) checkReferenceSlices(ctx context.Context, flowTest *loggingpipelineplumberv1beta1.FlowTest, target referenceTarget, indexes map[string]aggregator.Index) error {
+	logger := log.FromContext(ctx)
+
+	sliceLabels := client.MatchingLabels{
+		"loggingpipelineplumber.isala.me/flowtest":       flowTest.ObjectMeta.Name,
+		"loggingpipelineplumber.isala.me/reference-flow": target.key,
+	}
+
+	if target.Kind == "ClusterFlow" {
 		var flows flowv1beta1.ClusterFlowList
 
-		var referenceFlow flowv1beta1.ClusterFlow
-		if err := r.Get(ctx, types.NamespacedName{
-			Namespace: flowTest.Spec.ReferenceFlow.Namespace,
-			Name:      flowTest.Spec.ReferenceFlow.Name,
-		}, &referenceFlow); err != nil {
+		referenceFlow, err := r.referenceClusterFlow(ctx, target)
+		if err != nil {
 			return err
 		}
 
-		if err := r.List(ctx, &flows, &client.MatchingLabels{"loggingpipelineplumber.isala.me/flowtest": flowTest.ObjectMeta.Name}); client.IgnoreNotFound(err) != nil {
+		if err := r.List(ctx, &flows, sliceLabels); client.IgnoreNotFound(err) != nil {
 			logger.Error(err, fmt.Sprintf("failed to get provisioned %s", flows.Kind))
 			return err
 		}
 
+		configCheckFailure, err := r.configCheckFailure(ctx, target.results.Logging, flowTest.ObjectMeta.CreationTimestamp.Time)
+		if err != nil {
+			return err
+		}
+
 		for _, flow := range flows.Items {
-			passing, err := r.checkIndex(ctx, flow.ObjectMeta.Name)
-			if err != nil {
-				return err
-			}
-			if passing {
+			if indexes[flow.ObjectMeta.Name].LogCount > 0 {
 				logger.V(1).Info(fmt.Sprintf("flow %s is passing", flow.ObjectMeta.Name))
+				sample, err := r.sampleRecords(ctx, flow.ObjectMeta.Name)
+				if err != nil {
+					return err
+				}
 				if err := r.Delete(ctx, &flow); err != nil {
 					logger.Error(err, "failed to delete flow status")
 					return err
 				}
-				setPassingFilter(flow.Spec.Filters, referenceFlow.Spec.Filters, &flowTest)
-				setPassingClusterMatches(flow.Spec.Match, referenceFlow.Spec.Match, &flowTest)
+				setSliceStatus(&flowTest.Status, flow.ObjectMeta, loggingpipelineplumberv1beta1.Passing, "", sample)
+				switch flow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] {
+				case "isolated-filter":
+					setPassingFilter(flow.Spec.Filters, referenceFlow.Spec.Filters, target.results.IsolatedFilterStatus)
+				case "pipeline":
+					pipelineStatus := true
+					target.results.PipelineStatus = &pipelineStatus
+				case "message":
+					setDeliveredMessage(flowTest.Status.Comparison, flow.ObjectMeta.Labels)
+				default:
+					setPassingFilter(flow.Spec.Filters, referenceFlow.Spec.Filters, target.results.FilterStatus)
+					setPassingMatches(flow.ObjectMeta.Labels, target.results.MatchStatus)
+				}
+			} else {
+				outcome, message := pendingSliceOutcome(flow.Status, configCheckFailure)
+				setSliceStatus(&flowTest.Status, flow.ObjectMeta, outcome, message, nil)
 			}
 		}
 
+		excludes := make([]bool, len(referenceFlow.Spec.Match))
+		for i, match := range referenceFlow.Spec.Match {
+			excludes[i] = match.ClusterSelect == nil && match.ClusterExclude != nil
+		}
+		target.results.MatchResults = matchResults(excludes, target.results.MatchStatus, target.results.MatchResults)
+
+		health, err := r.destinationHealth(ctx, referenceFlow.ObjectMeta.Namespace, referenceFlow.Spec.LoggingRef, true, nil,
+			append(referenceFlow.Spec.GlobalOutputRefs, referenceFlow.Spec.OutputRefs...))
+		if err != nil {
+			return err
+		}
+		target.results.DestinationHealth = health
+
 	} else {
 		var flows flowv1beta1.FlowList
-		if err := r.List(ctx, &flows, &client.MatchingLabels{"loggingpipelineplumber.isala.me/flowtest": flowTest.ObjectMeta.Name}); client.IgnoreNotFound(err) != nil {
+
+		referenceFlow, err := r.referenceFlow(ctx, target)
+		if err != nil {
+			return err
+		}
+
+		if err := r.List(ctx, &flows, sliceLabels); client.IgnoreNotFound(err) != nil {
 			logger.Error(err, fmt.Sprintf("failed to get provisioned %s", flows.Kind))
 			return err
 		}
 
-		for _, flow := range flows.Items {
-			var referenceFlow flowv1beta1.Flow
-			if err := r.Get(ctx, types.NamespacedName{
-				Namespace: flowTest.Spec.ReferenceFlow.Namespace,
-				Name:      flowTest.Spec.ReferenceFlow.Name,
-			}, &referenceFlow); err != nil {
-				return err
-			}
+		configCheckFailure, err := r.configCheckFailure(ctx, target.results.Logging, flowTest.ObjectMeta.CreationTimestamp.Time)
+		if err != nil {
+			return err
+		}
 
-			passing, err := r.checkIndex(ctx, flow.ObjectMeta.Name)
-			if err != nil {
-				return err
-			}
-			if passing {
+		for _, flow := range flows.Items {
+			if indexes[flow.ObjectMeta.Name].LogCount > 0 {
 				logger.V(1).Info(fmt.Sprintf("flow %s is passing", flow.ObjectMeta.Name))
+				sample, err := r.sampleRecords(ctx, flow.ObjectMeta.Name)
+				if err != nil {
+					return err
+				}
 				if err := r.Delete(ctx, &flow); err != nil {
 					logger.Error(err, "failed to delete flow status")
 					return err
 				}
-
-				setPassingFilter(flow.Spec.Filters, referenceFlow.Spec.Filters, &flowTest)
-				setPassingMatches(flow.Spec.Match, referenceFlow.Spec.Match, &flowTest)
+				setSliceStatus(&flowTest.Status, flow.ObjectMeta, loggingpipelineplumberv1beta1.Passing, "", sample)
+				switch flow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] {
+				case "isolated-filter":
+					setPassingFilter(flow.Spec.Filters, referenceFlow.Spec.Filters, target.results.IsolatedFilterStatus)
+				case "pipeline":
+					pipelineStatus := true
+					target.results.PipelineStatus = &pipelineStatus
+				case "message":
+					setDeliveredMessage(flowTest.Status.Comparison, flow.ObjectMeta.Labels)
+				default:
+					setPassingFilter(flow.Spec.Filters, referenceFlow.Spec.Filters, target.results.FilterStatus)
+					setPassingMatches(flow.ObjectMeta.Labels, target.results.MatchStatus)
+				}
+			} else {
+				outcome, message := pendingSliceOutcome(flow.Status, configCheckFailure)
+				setSliceStatus(&flowTest.Status, flow.ObjectMeta, outcome, message, nil)
 			}
 		}
+
+		excludes := make([]bool, len(referenceFlow.Spec.Match))
+		for i, match := range referenceFlow.Spec.Match {
+			excludes[i] = match.Select == nil && match.Exclude != nil
+		}
+		target.results.MatchResults = matchResults(excludes, target.results.MatchStatus, target.results.MatchResults)
+
+		health, err := r.destinationHealth(ctx, referenceFlow.ObjectMeta.Namespace, referenceFlow.Spec.LoggingRef, false,
+			append(referenceFlow.Spec.LocalOutputRefs, referenceFlow.Spec.OutputRefs...), referenceFlow.Spec.GlobalOutputRefs)
+		if err != nil {
+			return err
+		}
+		target.results.DestinationHealth = health
 	}
-	return r.Status().Update(ctx, &flowTest)
+	return nil
 }
 
-func setPassingFilter(passingFilters []flowv1beta1.Filter, filters []flowv1beta1.Filter, flowTest *loggingpipelineplumberv1beta1.FlowTest) {
+func setPassingFilter(passingFilters []flowv1beta1.Filter, filters []flowv1beta1.Filter, filterStatus []bool) {
 	for _, passingFilter := range passingFilters {
 		for i, filter := range filters {
 			if reflect.DeepEqual(passingFilter, filter) {
-				flowTest.Status.FilterStatus[i] = true
+				filterStatus[i] = true
 			}
 		}
 	}
 }
 
-func setPassingMatches(passingMatches []flowv1beta1.Match, matches []flowv1beta1.Match, flowTest *loggingpipelineplumberv1beta1.FlowTest) {
-	for _, passingFilter := range passingMatches {
-		for i, filter := range matches {
-			if reflect.DeepEqual(passingFilter, filter) {
-				flowTest.Status.MatchStatus[i] = true
-			}
-		}
+// setPassingMatches marks the match probe behind the given slice labels as passing,
+// match probes are deployed first so their test-id is the index of the match
+func setPassingMatches(labels map[string]string, matchStatus []bool) {
+	if labels["loggingpipelineplumber.isala.me/test-type"] != "match" {
+		return
+	}
+	i, err := strconv.Atoi(labels["loggingpipelineplumber.isala.me/test-id"])
+	if err != nil || i < 0 || i >= len(matchStatus) {
+		return
 	}
+	matchStatus[i] = true
 }
 
-func setPassingClusterMatches(passingMatches []flowv1beta1.ClusterMatch, matches []flowv1beta1.ClusterMatch, flowTest *loggingpipelineplumberv1beta1.FlowTest) {
-	for _, passingFilter := range passingMatches {
-		for i, filter := range matches {
-			if reflect.DeepEqual(passingFilter, filter) {
-				flowTest.Status.MatchStatus[i] = true
-			}
+// matchResults replays the first-match-wins evaluation of logging-operator over the probe results,
+// the first select or exclude that matches the simulated pod decides and the rest are never reached
+func matchResults(excludes []bool, matchStatus []bool, previous []loggingpipelineplumberv1beta1.MatchResult) []loggingpipelineplumberv1beta1.MatchResult {
+	results := make([]loggingpipelineplumberv1beta1.MatchResult, len(matchStatus))
+	decidedBy := -1
+	for i, matched := range matchStatus {
+		switch {
+		case i < len(previous) && previous[i].Outcome == loggingpipelineplumberv1beta1.Untestable:
+			results[i] = previous[i]
+		case decidedBy >= 0:
+			results[i].Outcome = loggingpipelineplumberv1beta1.NotReached
+			results[i].Message = fmt.Sprintf("match #%d already decided the outcome", decidedBy)
+		case !matched:
+			results[i].Outcome = loggingpipelineplumberv1beta1.NotMatched
+		case excludes[i]:
+			results[i].Outcome = loggingpipelineplumberv1beta1.Excluded
+			decidedBy = i
+		default:
+			results[i].Outcome = loggingpipelineplumberv1beta1.Selected
+			decidedBy = i
 		}
 	}
+	return results
 }
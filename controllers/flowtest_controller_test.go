@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	"github.com/banzaicloud/logging-operator/pkg/sdk/model/filter"
+	"github.com/mrsupiri/logging-pipeline-plumber/pkg/aggregator/fake"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testScheme knows about the kubernetes, logging-operator and flowtest types
+func testScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme, flowv1beta1.AddToScheme, loggingpipelineplumberv1beta1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return scheme
+}
+
+func TestCheckForPassingFlowTest(t *testing.T) {
+	scheme := testScheme(t)
+
+	flowTest := loggingpipelineplumberv1beta1.FlowTest{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "uid"},
+		Spec: loggingpipelineplumberv1beta1.FlowTestSpec{
+			ReferencePod: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Pod", Name: "app", Namespace: "default"},
+			InlineFlow: &flowv1beta1.FlowSpec{
+				Match: []flowv1beta1.Match{
+					{Select: &flowv1beta1.Select{Labels: map[string]string{"app": "a"}}},
+					{Select: &flowv1beta1.Select{Labels: map[string]string{"app": "b"}}},
+				},
+			},
+		},
+		Status: loggingpipelineplumberv1beta1.FlowTestStatus{
+			FlowResults: loggingpipelineplumberv1beta1.FlowResults{MatchStatus: []bool{false, false}},
+			Status:      loggingpipelineplumberv1beta1.Running,
+		},
+	}
+	matchSlice := func(name string, testID string) *flowv1beta1.Flow {
+		return &flowv1beta1.Flow{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels: map[string]string{
+				"loggingpipelineplumber.isala.me/flowtest":       "test",
+				"loggingpipelineplumber.isala.me/reference-flow": primaryReference,
+				"loggingpipelineplumber.isala.me/test-type":      "match",
+				"loggingpipelineplumber.isala.me/test-id":        testID,
+			},
+		}}
+	}
+
+	kubeClient := fakeclient.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&flowTest, matchSlice("uid-0-match", "0"), matchSlice("uid-1-match", "1")).
+		Build()
+	aggregatorClient := fake.NewClient()
+	aggregatorClient.Receive("uid-0-match", `{"log":"hello"}`)
+	aggregatorClient.Reject("uid-1-match")
+
+	recorder := record.NewFakeRecorder(10)
+	r := &FlowTestReconciler{Client: kubeClient, Scheme: scheme, Recorder: recorder, Aggregator: aggregatorClient}
+	ctx := context.WithValue(context.Background(), "flowTest", flowTest)
+	if err := r.checkForPassingFlowTest(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var got loggingpipelineplumberv1beta1.FlowTest
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test"}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Status.MatchStatus[0] || got.Status.MatchStatus[1] {
+		t.Errorf("expected only the first match to pass, got %v", got.Status.MatchStatus)
+	}
+	if len(got.Status.Slices) != 2 || got.Status.Slices[0].Outcome != loggingpipelineplumberv1beta1.Passing {
+		t.Errorf("expected the first slice to pass, got %+v", got.Status.Slices)
+	}
+	if len(got.Status.Slices[0].Sample) != 1 || got.Status.Slices[0].Sample[0] != `{"log":"hello"}` {
+		t.Errorf("expected the received record as the sample, got %v", got.Status.Slices[0].Sample)
+	}
+
+	if got.Status.Slices[1].RejectedWrites != 1 {
+		t.Errorf("expected the rejected write to be counted, got %+v", got.Status.Slices[1])
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected a security event for the rejected write, got %d events", len(recorder.Events))
+	}
+
+	var slice flowv1beta1.Flow
+	err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "uid-0-match"}, &slice)
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected the passing slice to be deleted, got %v", err)
+	}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "uid-1-match"}, &slice); err != nil {
+		t.Errorf("expected the pending slice to be kept, got %v", err)
+	}
+}
+
+func TestCheckReferenceSlicesBySlicingMode(t *testing.T) {
+	grep := func(key string) flowv1beta1.Filter {
+		return flowv1beta1.Filter{Grep: &filter.GrepConfig{Regexp: []filter.RegexpSection{{Key: key, Pattern: ".*"}}}}
+	}
+	filters := []flowv1beta1.Filter{grep("first"), grep("second")}
+
+	for _, tc := range []struct {
+		name       string
+		modes      []loggingpipelineplumberv1beta1.SlicingMode
+		sliceTypes []string
+		cumulative []bool
+		isolated   []bool
+	}{
+		{
+			name:       "cumulative only",
+			modes:      []loggingpipelineplumberv1beta1.SlicingMode{loggingpipelineplumberv1beta1.Cumulative},
+			sliceTypes: []string{"filter", "filter", "pipeline"},
+			cumulative: []bool{true, true},
+		},
+		{
+			name:       "isolated only",
+			modes:      []loggingpipelineplumberv1beta1.SlicingMode{loggingpipelineplumberv1beta1.Isolated},
+			sliceTypes: []string{"isolated-filter", "isolated-filter", "pipeline"},
+			isolated:   []bool{false, true},
+		},
+		{
+			name:       "both",
+			modes:      []loggingpipelineplumberv1beta1.SlicingMode{loggingpipelineplumberv1beta1.Cumulative, loggingpipelineplumberv1beta1.Isolated},
+			sliceTypes: []string{"filter", "filter", "isolated-filter", "isolated-filter", "pipeline"},
+			cumulative: []bool{true, true},
+			isolated:   []bool{false, true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			flowTest := loggingpipelineplumberv1beta1.FlowTest{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "uid"},
+				Spec: loggingpipelineplumberv1beta1.FlowTestSpec{
+					ReferencePod: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Pod", Name: "app", Namespace: "default"},
+					InlineFlow:   &flowv1beta1.FlowSpec{Filters: filters},
+					SlicingModes: tc.modes,
+				},
+			}
+			logging := &flowv1beta1.Logging{
+				ObjectMeta: metav1.ObjectMeta{Name: "logging"},
+				Spec:       flowv1beta1.LoggingSpec{ControlNamespace: "logging"},
+			}
+			kubeClient := fakeclient.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(logging).Build()
+			aggregatorClient := fake.NewClient()
+			r := &FlowTestReconciler{Client: kubeClient, AggregatorNamespace: "plumber", Aggregator: aggregatorClient}
+			ctx := context.WithValue(context.Background(), "flowTest", flowTest)
+
+			target := referenceTargets(&flowTest)[0]
+			if err := r.deployReferenceSlices(ctx, map[string]string{"app": "simulation"}, nil, &flowTest, target); err != nil {
+				t.Fatal(err)
+			}
+
+			var slices flowv1beta1.FlowList
+			if err := kubeClient.List(ctx, &slices); err != nil {
+				t.Fatal(err)
+			}
+			var sliceTypes []string
+			for _, slice := range slices.Items {
+				sliceTypes = append(sliceTypes, slice.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"])
+				// only the slices running the second filter let the logs through
+				for _, sliceFilter := range slice.Spec.Filters {
+					if reflect.DeepEqual(sliceFilter, filters[1]) {
+						aggregatorClient.Receive(slice.ObjectMeta.Name, `{"log":"a"}`)
+					}
+				}
+			}
+			sort.Strings(sliceTypes)
+			if !reflect.DeepEqual(sliceTypes, tc.sliceTypes) {
+				t.Errorf("expected the slices %v, got %v", tc.sliceTypes, sliceTypes)
+			}
+
+			indexes, err := aggregatorClient.Indexes(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.checkReferenceSlices(ctx, &flowTest, target, indexes); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(flowTest.Status.FilterStatus, tc.cumulative) {
+				t.Errorf("expected the cumulative filter status %v, got %v", tc.cumulative, flowTest.Status.FilterStatus)
+			}
+			if !reflect.DeepEqual(flowTest.Status.IsolatedFilterStatus, tc.isolated) {
+				t.Errorf("expected the isolated filter status %v, got %v", tc.isolated, flowTest.Status.IsolatedFilterStatus)
+			}
+			if flowTest.Status.PipelineStatus == nil || !*flowTest.Status.PipelineStatus {
+				t.Error("expected the pipeline slice to pass")
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	"github.com/banzaicloud/logging-operator/pkg/sdk/model/common"
+	"github.com/banzaicloud/logging-operator/pkg/sdk/model/filter"
+	"github.com/banzaicloud/logging-operator/pkg/sdk/model/output"
+	"github.com/banzaicloud/operator-tools/pkg/secret"
+	"github.com/mrsupiri/logging-pipeline-plumber/pkg/aggregator"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ingestionKeySecret holds the key the ingestion tokens are derived from, it lives next to the aggregator
+	ingestionKeySecret = "logging-plumber-log-aggregator"
+	ingestionKeyField  = "ingestion-key"
+	// EventReasonSecurity marks the events about writes the aggregator rejected
+	EventReasonSecurity = "Security"
+)
+
+// ingestionKey returns the key shared with the aggregator, a random one is minted the first time
+func (r *FlowTestReconciler) ingestionKey(ctx context.Context) ([]byte, error) {
+	logger := log.FromContext(ctx)
+
+	var keySecret v1.Secret
+	err := r.Get(ctx, client.ObjectKey{Name: ingestionKeySecret, Namespace: r.AggregatorNamespace}, &keySecret)
+	if err == nil {
+		return keySecret.Data[ingestionKeyField], nil
+	}
+	if !apierrors.IsNotFound(err) {
+		logger.Error(err, "failed to get the ingestion key")
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	keySecret = v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "V1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ingestionKeySecret,
+			Namespace: r.AggregatorNamespace,
+			Labels: GetLabels("logging-plumber-log-aggregator", nil,
+				map[string]string{"loggingpipelineplumber.isala.me/component": "log-aggregator"}),
+		},
+		Data: map[string][]byte{ingestionKeyField: []byte(hex.EncodeToString(key))},
+	}
+	if err := r.Create(ctx, &keySecret); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			// another reconcile minted it first
+			return r.ingestionKey(ctx)
+		}
+		logger.Error(err, "failed to create the ingestion key")
+		return nil, err
+	}
+	logger.V(1).Info("minted the ingestion key")
+	return keySecret.Data[ingestionKeyField], nil
+}
+
+// ingestionSecretName is the name of the secret the outputs of the flowtest take their credentials from
+func ingestionSecretName(flowTest loggingpipelineplumberv1beta1.FlowTest) string {
+	return fmt.Sprintf("%s-ingestion", flowTest.ObjectMeta.UID)
+}
+
+// provisionIngestionSecret puts the token of the flowtest and the CA of the aggregator next to its outputs,
+// outputs can only refer to secrets of their own namespace so there is one per namespace the slices go to
+func (r *FlowTestReconciler) provisionIngestionSecret(ctx context.Context, flowTest loggingpipelineplumberv1beta1.FlowTest, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	key, err := r.ingestionKey(ctx)
+	if err != nil {
+		return err
+	}
+	caBundle, err := r.aggregatorCertificates(ctx)
+	if err != nil {
+		return err
+	}
+
+	tokenSecret := v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "V1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ingestionSecretName(flowTest),
+			Namespace: namespace,
+			Labels:    GetLabels("log-aggregator-ingestion", &flowTest),
+		},
+		Data: map[string][]byte{
+			"username": []byte(flowTest.ObjectMeta.UID),
+			"password": []byte(aggregator.IngestionToken(key, string(flowTest.ObjectMeta.UID))),
+			"ca.crt":   caBundle,
+		},
+	}
+	if err := r.Create(ctx, &tokenSecret); err != nil && !apierrors.IsAlreadyExists(err) {
+		logger.Error(err, "failed to create the ingestion secret", "namespace", namespace)
+		return err
+	}
+	return nil
+}
+
+// updateIngestionSecrets puts the CA bundle into the ingestion secrets of every flowtest
+func (r *FlowTestReconciler) updateIngestionSecrets(ctx context.Context, caBundle []byte) error {
+	logger := log.FromContext(ctx)
+
+	var secretList v1.SecretList
+	if err := r.List(ctx, &secretList, &client.MatchingLabels{"app.kubernetes.io/name": "log-aggregator-ingestion"}); err != nil {
+		logger.Error(err, "failed to get the ingestion secrets")
+		return err
+	}
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		if bytes.Equal(secret.Data["ca.crt"], caBundle) {
+			continue
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data["ca.crt"] = caBundle
+		if err := r.Update(ctx, secret); err != nil {
+			logger.Error(err, "failed to update the ingestion secret", "namespace", secret.ObjectMeta.Namespace)
+			return err
+		}
+	}
+	return nil
+}
+
+func ingestionSecretKey(flowTest loggingpipelineplumberv1beta1.FlowTest, key string) *v1.SecretKeySelector {
+	return &v1.SecretKeySelector{
+		LocalObjectReference: v1.LocalObjectReference{Name: ingestionSecretName(flowTest)},
+		Key:                  key,
+	}
+}
+
+// ingestionOutput ships to the aggregator over TLS and authenticates with the token of the flowtest
+func (r *FlowTestReconciler) ingestionOutput(flowTest loggingpipelineplumberv1beta1.FlowTest) *output.HTTPOutputConfig {
+	return &output.HTTPOutputConfig{
+		Endpoint: fmt.Sprintf("https://logging-plumber-log-aggregator.%s.svc", r.AggregatorNamespace),
+		// fluentd takes the CA as a file, so it's mounted rather than inlined
+		TlsCACertPath: &secret.Secret{MountFrom: &secret.ValueFrom{SecretKeyRef: ingestionSecretKey(flowTest, "ca.crt")}},
+		TlsVerifyMode: "peer",
+		Auth: &output.HTTPAuth{
+			Username: &secret.Secret{ValueFrom: &secret.ValueFrom{SecretKeyRef: ingestionSecretKey(flowTest, "username")}},
+			Password: &secret.Secret{ValueFrom: &secret.ValueFrom{SecretKeyRef: ingestionSecretKey(flowTest, "password")}},
+		},
+		Buffer: &output.Buffer{
+			FlushMode:     "interval",
+			FlushInterval: "1s",
+		},
+	}
+}
+
+// validateOutputProtocol turns down forward outputs until they can ship over TLS, the aggregator doesn't
+// take logs in plaintext so it doesn't run its forward receiver either
+func validateOutputProtocol(flowTest loggingpipelineplumberv1beta1.FlowTest) error {
+	if flowTest.Spec.OutputProtocol == loggingpipelineplumberv1beta1.ForwardProtocol {
+		return fmt.Errorf("spec.outputProtocol: forward isn't supported yet, the forward output of logging-operator can't use TLS")
+	}
+	return nil
+}
+
+// ingestionForwardOutput is the forward counterpart of ingestionOutput, the forward output of logging-operator
+// can't turn on TLS so it only authenticates, using the token as both the shared key and the password
+func (r *FlowTestReconciler) ingestionForwardOutput(flowTest loggingpipelineplumberv1beta1.FlowTest) *output.ForwardOutput {
+	token := &secret.Secret{ValueFrom: &secret.ValueFrom{SecretKeyRef: ingestionSecretKey(flowTest, "password")}}
+	return &output.ForwardOutput{
+		FluentdServers: []output.FluentdServer{{
+			Host:      fmt.Sprintf("logging-plumber-log-aggregator.%s.svc", r.AggregatorNamespace),
+			Port:      24224,
+			SharedKey: token,
+			Username:  &secret.Secret{ValueFrom: &secret.ValueFrom{SecretKeyRef: ingestionSecretKey(flowTest, "username")}},
+			Password:  token,
+		}},
+		// the shared key of the server takes precedence, this one is only there because fluentd requires it
+		Security: &common.Security{
+			SelfHostname: string(flowTest.ObjectMeta.UID),
+			SharedKey:    string(flowTest.ObjectMeta.UID),
+			UserAuth:     true,
+		},
+		Buffer: &output.Buffer{
+			FlushMode:     "interval",
+			FlushInterval: "1s",
+		},
+	}
+}
+
+// sliceOutput points the output of a slice to its index, HTTP outputs ship to the path of the index
+// while forward outputs ship under the tag the slice flow gives its logs
+func sliceOutput(spec *flowv1beta1.OutputSpec, name string) []flowv1beta1.Filter {
+	if spec.HTTPOutput != nil {
+		spec.HTTPOutput.Endpoint = fmt.Sprintf("%s/%s/", spec.HTTPOutput.Endpoint, name)
+		return nil
+	}
+	return []flowv1beta1.Filter{{TagNormaliser: &filter.TagNormaliser{Format: name}}}
+}
+
+// recordRejectedWrites raises a security event for every slice the aggregator rejected new writes to,
+// these are writes from outside of the flowtest trying to make a slice look like it passed
+func (r *FlowTestReconciler) recordRejectedWrites(flowTest *loggingpipelineplumberv1beta1.FlowTest, indexes map[string]aggregator.Index) {
+	for i := range flowTest.Status.Slices {
+		slice := &flowTest.Status.Slices[i]
+		rejected := indexes[slice.Name].Rejected
+		if rejected <= slice.RejectedWrites {
+			continue
+		}
+		r.Recorder.Event(flowTest, v1.EventTypeWarning, EventReasonSecurity,
+			fmt.Sprintf("log aggregator rejected %d unauthenticated or cross-test writes to slice %s", rejected-slice.RejectedWrites, slice.Name))
+		slice.RejectedWrites = rejected
+	}
+}
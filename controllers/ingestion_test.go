@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"testing"
+
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+)
+
+func TestValidateOutputProtocol(t *testing.T) {
+	for _, tc := range []struct {
+		protocol loggingpipelineplumberv1beta1.OutputProtocol
+		valid    bool
+	}{
+		{protocol: "", valid: true},
+		{protocol: loggingpipelineplumberv1beta1.HTTPProtocol, valid: true},
+		// forward outputs would ship the logs in plaintext
+		{protocol: loggingpipelineplumberv1beta1.ForwardProtocol, valid: false},
+	} {
+		flowTest := loggingpipelineplumberv1beta1.FlowTest{}
+		flowTest.Spec.OutputProtocol = tc.protocol
+		if err := validateOutputProtocol(flowTest); (err == nil) != tc.valid {
+			t.Errorf("expected %q to be valid %v, got %v", tc.protocol, tc.valid, err)
+		}
+	}
+}
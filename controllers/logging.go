@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// referenceLogging finds the Logging resource that processes flows with the given loggingRef
+// and makes sure it would pick up slices deployed to the given namespace
+func (r *FlowTestReconciler) referenceLogging(ctx context.Context, loggingRef string, namespace string, clusterScoped bool) (*flowv1beta1.Logging, error) {
+	logging, err := r.loggingByRef(ctx, loggingRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if clusterScoped {
+		if namespace != logging.Spec.ControlNamespace && !logging.Spec.AllowClusterResourcesFromAllNamespaces {
+			return nil, fmt.Errorf("logging %s only accepts cluster resources from %s, not from %s", logging.ObjectMeta.Name, logging.Spec.ControlNamespace, namespace)
+		}
+	} else if len(logging.Spec.WatchNamespaces) > 0 && !contains(logging.Spec.WatchNamespaces, namespace) {
+		return nil, fmt.Errorf("logging %s does not watch flows in %s", logging.ObjectMeta.Name, namespace)
+	}
+
+	return logging, nil
+}
+
+// loggingByRef finds the only Logging resource with the given loggingRef
+func (r *FlowTestReconciler) loggingByRef(ctx context.Context, loggingRef string) (*flowv1beta1.Logging, error) {
+	var loggings flowv1beta1.LoggingList
+	if err := r.List(ctx, &loggings); err != nil {
+		return nil, err
+	}
+
+	var logging *flowv1beta1.Logging
+	for i := range loggings.Items {
+		if loggings.Items[i].Spec.LoggingRef == loggingRef {
+			if logging != nil {
+				return nil, fmt.Errorf("both %s and %s have loggingRef %q", logging.ObjectMeta.Name, loggings.Items[i].ObjectMeta.Name, loggingRef)
+			}
+			logging = &loggings.Items[i]
+		}
+	}
+	if logging == nil {
+		return nil, fmt.Errorf("no Logging resource found with loggingRef %q", loggingRef)
+	}
+
+	return logging, nil
+}
+
+// configCheckFailure returns the output of a failed fluentd config check of the given Logging that ran after
+// the given time, logging-operator keeps the previous configuration when the check fails so none of the
+// slices deployed since then ever receive logs
+func (r *FlowTestReconciler) configCheckFailure(ctx context.Context, loggingName string, since time.Time) (string, error) {
+	if loggingName == "" {
+		return "", nil
+	}
+
+	var logging flowv1beta1.Logging
+	if err := r.Get(ctx, types.NamespacedName{Name: loggingName}, &logging); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+
+	for hash, passed := range logging.Status.ConfigCheckResults {
+		if passed {
+			continue
+		}
+
+		var checkPod v1.Pod
+		podName := fmt.Sprintf("%s-fluentd-configcheck-%s", logging.ObjectMeta.Name, hash)
+		if err := r.Get(ctx, types.NamespacedName{Namespace: logging.Spec.ControlNamespace, Name: podName}, &checkPod); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return "", err
+		}
+		if checkPod.ObjectMeta.CreationTimestamp.Time.Before(since) {
+			continue
+		}
+
+		message := fmt.Sprintf("fluentd config check %s of logging %s failed", podName, logging.ObjectMeta.Name)
+		if r.KubeClient == nil {
+			return message, nil
+		}
+
+		tailLines := int64(10)
+		checkLogs, err := r.KubeClient.CoreV1().Pods(checkPod.ObjectMeta.Namespace).GetLogs(podName, &v1.PodLogOptions{TailLines: &tailLines}).DoRaw(ctx)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "failed to read config check logs", "pod", podName)
+			return message, nil
+		}
+		return fmt.Sprintf("%s: %s", message, strings.TrimSpace(string(checkLogs))), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReferenceLogging(t *testing.T) {
+	logging := func(name string, loggingRef string, spec flowv1beta1.LoggingSpec) *flowv1beta1.Logging {
+		spec.LoggingRef = loggingRef
+		spec.ControlNamespace = "logging"
+		return &flowv1beta1.Logging{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+	}
+	kubeClient := fakeclient.NewClientBuilder().
+		WithScheme(testScheme(t)).
+		WithObjects(
+			logging("default", "", flowv1beta1.LoggingSpec{}),
+			logging("watching", "watching", flowv1beta1.LoggingSpec{WatchNamespaces: []string{"apps"}}),
+			logging("all", "all", flowv1beta1.LoggingSpec{AllowClusterResourcesFromAllNamespaces: true}),
+			logging("first", "twice", flowv1beta1.LoggingSpec{}),
+			logging("second", "twice", flowv1beta1.LoggingSpec{}),
+		).
+		Build()
+	r := &FlowTestReconciler{Client: kubeClient}
+
+	for _, tc := range []struct {
+		name          string
+		loggingRef    string
+		namespace     string
+		clusterScoped bool
+		want          string
+		err           string
+	}{
+		{name: "default loggingRef", namespace: "apps", want: "default"},
+		{name: "watched namespace", loggingRef: "watching", namespace: "apps", want: "watching"},
+		{name: "namespace outside watchNamespaces", loggingRef: "watching", namespace: "other", err: "logging watching does not watch flows in other"},
+		{name: "cluster flow in the control namespace", namespace: "logging", clusterScoped: true, want: "default"},
+		{name: "cluster flow outside the control namespace", namespace: "apps", clusterScoped: true, err: "logging default only accepts cluster resources from logging, not from apps"},
+		{name: "cluster flows from all namespaces", loggingRef: "all", namespace: "apps", clusterScoped: true, want: "all"},
+		{name: "duplicate loggingRef", loggingRef: "twice", namespace: "apps", err: `both first and second have loggingRef "twice"`},
+		{name: "missing loggingRef", loggingRef: "missing", namespace: "apps", err: `no Logging resource found with loggingRef "missing"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logging, err := r.referenceLogging(context.Background(), tc.loggingRef, tc.namespace, tc.clusterScoped)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("expected the error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if logging.ObjectMeta.Name != tc.want {
+				t.Errorf("expected logging %s, got %s", tc.want, logging.ObjectMeta.Name)
+			}
+		})
+	}
+}
+
+func TestConfigCheckFailure(t *testing.T) {
+	testCreation := time.Now().Add(-time.Minute)
+	checkPod := func(hash string, created time.Time) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              "logging-fluentd-configcheck-" + hash,
+			Namespace:         "logging",
+			CreationTimestamp: metav1.NewTime(created),
+		}}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		results map[string]bool
+		pods    []*v1.Pod
+		want    string
+	}{
+		{name: "no checks"},
+		{
+			name:    "passed check",
+			results: map[string]bool{"new": true},
+			pods:    []*v1.Pod{checkPod("new", testCreation.Add(time.Second))},
+		},
+		{
+			name:    "failed before the test",
+			results: map[string]bool{"old": false},
+			pods:    []*v1.Pod{checkPod("old", testCreation.Add(-time.Second))},
+		},
+		{
+			name:    "failed check pod is gone",
+			results: map[string]bool{"gone": false},
+		},
+		{
+			name:    "failed after the test",
+			results: map[string]bool{"old": false, "new": false},
+			pods:    []*v1.Pod{checkPod("old", testCreation.Add(-time.Second)), checkPod("new", testCreation.Add(time.Second))},
+			want:    "fluentd config check logging-fluentd-configcheck-new of logging logging failed",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logging := &flowv1beta1.Logging{
+				ObjectMeta: metav1.ObjectMeta{Name: "logging"},
+				Spec:       flowv1beta1.LoggingSpec{ControlNamespace: "logging"},
+				Status:     flowv1beta1.LoggingStatus{ConfigCheckResults: tc.results},
+			}
+			builder := fakeclient.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(logging)
+			for _, pod := range tc.pods {
+				builder = builder.WithObjects(pod)
+			}
+			r := &FlowTestReconciler{Client: builder.Build()}
+
+			got, err := r.configCheckFailure(context.Background(), "logging", testCreation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+
+	t.Run("unknown logging", func(t *testing.T) {
+		r := &FlowTestReconciler{Client: fakeclient.NewClientBuilder().WithScheme(testScheme(t)).Build()}
+		if got, err := r.configCheckFailure(context.Background(), "missing", testCreation); err != nil || got != "" {
+			t.Errorf("expected a missing logging to be ignored, got %q and %v", got, err)
+		}
+		if got, err := r.configCheckFailure(context.Background(), "", testCreation); err != nil || got != "" {
+			t.Errorf("expected no logging to be ignored, got %q and %v", got, err)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+)
+
+// validateSentMessages makes sure every sent message is a string or an object, that the delays refer to one
+// of them and that the emission schedule makes sense
+func validateSentMessages(flowTest loggingpipelineplumberv1beta1.FlowTest) error {
+	if len(flowTest.Spec.SentMessages) == 0 {
+		return fmt.Errorf("spec.sentMessages: at least one message has to be sent")
+	}
+	for i, message := range flowTest.Spec.SentMessages {
+		if message.IsObject() {
+			var object map[string]interface{}
+			if err := json.Unmarshal(message.Raw, &object); err != nil {
+				return fmt.Errorf("spec.sentMessages[%d]: invalid object: %w", i, err)
+			}
+			continue
+		}
+		var line string
+		if err := json.Unmarshal(message.Raw, &line); err != nil {
+			return fmt.Errorf("spec.sentMessages[%d]: messages have to be strings or objects", i)
+		}
+	}
+
+	if delay := flowTest.Spec.Simulator.EventDelay; delay != nil && delay.Duration < 0 {
+		return fmt.Errorf("spec.simulator.eventDelay can't be negative")
+	}
+	for i, delay := range flowTest.Spec.Simulator.MessageDelays {
+		if delay.Message < 0 || delay.Message >= len(flowTest.Spec.SentMessages) {
+			return fmt.Errorf("spec.simulator.messageDelays[%d]: there is no sent message #%d", i, delay.Message)
+		}
+		if delay.Delay.Duration < 0 {
+			return fmt.Errorf("spec.simulator.messageDelays[%d]: delay can't be negative", i)
+		}
+	}
+
+	if emission := flowTest.Spec.Simulator.Emission; emission != nil {
+		if emission.Rate < 0 || emission.Burst < 0 || emission.Repetitions < 0 {
+			return fmt.Errorf("spec.simulator.emission: rate, burst and repetitions can't be negative")
+		}
+		if (emission.Jitter != nil && emission.Jitter.Duration < 0) || (emission.StartDelay != nil && emission.StartDelay.Duration < 0) {
+			return fmt.Errorf("spec.simulator.emission: jitter and startDelay can't be negative")
+		}
+	}
+	return nil
+}
+
+// simulatorArgs tells the pod simulator how to log the sent messages mounted at /messages.json
+func simulatorArgs(flowTest loggingpipelineplumberv1beta1.FlowTest) []string {
+	args := []string{"-log_file", "/messages.json", "-format", "json"}
+	if delay := flowTest.Spec.Simulator.EventDelay; delay != nil {
+		args = append(args, "-delay", delay.Duration.String())
+	}
+	for _, delay := range flowTest.Spec.Simulator.MessageDelays {
+		args = append(args, "-message_delay", fmt.Sprintf("%d=%s", delay.Message, delay.Delay.Duration))
+	}
+
+	emission := flowTest.Spec.Simulator.Emission
+	if emission == nil {
+		return args
+	}
+	if emission.Rate > 0 {
+		args = append(args, "-rate", strconv.Itoa(emission.Rate))
+	}
+	if emission.Burst > 0 {
+		args = append(args, "-burst", strconv.Itoa(emission.Burst))
+	}
+	if emission.Repetitions > 0 {
+		args = append(args, "-repetitions", strconv.Itoa(emission.Repetitions))
+	}
+	if emission.Jitter != nil {
+		args = append(args, "-jitter", emission.Jitter.Duration.String())
+	}
+	if emission.StartDelay != nil {
+		args = append(args, "-start_delay", emission.StartDelay.Duration.String())
+	}
+	return args
+}
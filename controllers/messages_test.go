@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func sentMessages(raw ...string) []loggingpipelineplumberv1beta1.SentMessage {
+	messages := make([]loggingpipelineplumberv1beta1.SentMessage, 0, len(raw))
+	for _, message := range raw {
+		messages = append(messages, loggingpipelineplumberv1beta1.SentMessage{Raw: []byte(message)})
+	}
+	return messages
+}
+
+func TestValidateSentMessages(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		messages  []loggingpipelineplumberv1beta1.SentMessage
+		simulator loggingpipelineplumberv1beta1.SimulatorSpec
+		// err is a part of the expected error, empty when the spec is valid
+		err string
+	}{
+		{
+			name: "no messages",
+			err:  "at least one message has to be sent",
+		},
+		{
+			name:     "strings and objects",
+			messages: sentMessages(`"plain"`, `{"level":"info","nested":{"a":1}}`, `"multi\nline"`),
+		},
+		{
+			name:     "invalid object",
+			messages: sentMessages(`"plain"`, `{"level":`),
+			err:      "spec.sentMessages[1]: invalid object",
+		},
+		{
+			name:     "number",
+			messages: sentMessages(`42`),
+			err:      "spec.sentMessages[0]: messages have to be strings or objects",
+		},
+		{
+			name:     "array",
+			messages: sentMessages(`"plain"`, `["a","b"]`),
+			err:      "spec.sentMessages[1]: messages have to be strings or objects",
+		},
+		{
+			name:     "message delays",
+			messages: sentMessages(`"a"`, `"b"`),
+			simulator: loggingpipelineplumberv1beta1.SimulatorSpec{
+				EventDelay:    &metav1.Duration{Duration: time.Second},
+				MessageDelays: []loggingpipelineplumberv1beta1.MessageDelay{{Message: 1, Delay: metav1.Duration{Duration: 0}}},
+			},
+		},
+		{
+			name:      "negative event delay",
+			messages:  sentMessages(`"a"`),
+			simulator: loggingpipelineplumberv1beta1.SimulatorSpec{EventDelay: &metav1.Duration{Duration: -time.Second}},
+			err:       "spec.simulator.eventDelay can't be negative",
+		},
+		{
+			name:     "delay of a missing message",
+			messages: sentMessages(`"a"`, `"b"`),
+			simulator: loggingpipelineplumberv1beta1.SimulatorSpec{
+				MessageDelays: []loggingpipelineplumberv1beta1.MessageDelay{{Message: 2, Delay: metav1.Duration{Duration: time.Second}}},
+			},
+			err: "spec.simulator.messageDelays[0]: there is no sent message #2",
+		},
+		{
+			name:     "negative message delay",
+			messages: sentMessages(`"a"`),
+			simulator: loggingpipelineplumberv1beta1.SimulatorSpec{
+				MessageDelays: []loggingpipelineplumberv1beta1.MessageDelay{{Message: 0, Delay: metav1.Duration{Duration: -time.Second}}},
+			},
+			err: "spec.simulator.messageDelays[0]: delay can't be negative",
+		},
+		{
+			name:     "emission",
+			messages: sentMessages(`"a"`),
+			simulator: loggingpipelineplumberv1beta1.SimulatorSpec{Emission: &loggingpipelineplumberv1beta1.EmissionSpec{
+				Rate: 10, Burst: 5, Repetitions: 3, Jitter: &metav1.Duration{Duration: time.Second},
+			}},
+		},
+		{
+			name:      "negative repetitions",
+			messages:  sentMessages(`"a"`),
+			simulator: loggingpipelineplumberv1beta1.SimulatorSpec{Emission: &loggingpipelineplumberv1beta1.EmissionSpec{Repetitions: -1}},
+			err:       "spec.simulator.emission: rate, burst and repetitions can't be negative",
+		},
+		{
+			name:     "negative start delay",
+			messages: sentMessages(`"a"`),
+			simulator: loggingpipelineplumberv1beta1.SimulatorSpec{Emission: &loggingpipelineplumberv1beta1.EmissionSpec{
+				StartDelay: &metav1.Duration{Duration: -time.Second},
+			}},
+			err: "spec.simulator.emission: jitter and startDelay can't be negative",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			flowTest := loggingpipelineplumberv1beta1.FlowTest{}
+			flowTest.Spec.SentMessages = tc.messages
+			flowTest.Spec.Simulator = tc.simulator
+
+			err := validateSentMessages(flowTest)
+			if tc.err == "" && err != nil {
+				t.Errorf("expected the spec to be valid, got %s", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("expected an error with %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestSimulatorArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		simulator loggingpipelineplumberv1beta1.SimulatorSpec
+		want      []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"-log_file", "/messages.json", "-format", "json"},
+		},
+		{
+			name: "delays",
+			simulator: loggingpipelineplumberv1beta1.SimulatorSpec{
+				EventDelay: &metav1.Duration{Duration: 500 * time.Millisecond},
+				MessageDelays: []loggingpipelineplumberv1beta1.MessageDelay{
+					{Message: 0, Delay: metav1.Duration{Duration: 0}},
+					{Message: 2, Delay: metav1.Duration{Duration: time.Minute}},
+				},
+			},
+			want: []string{"-log_file", "/messages.json", "-format", "json", "-delay", "500ms",
+				"-message_delay", "0=0s", "-message_delay", "2=1m0s"},
+		},
+		{
+			name: "emission",
+			simulator: loggingpipelineplumberv1beta1.SimulatorSpec{Emission: &loggingpipelineplumberv1beta1.EmissionSpec{
+				Rate:        10,
+				Burst:       5,
+				Repetitions: 3,
+				Jitter:      &metav1.Duration{Duration: 200 * time.Millisecond},
+				StartDelay:  &metav1.Duration{Duration: 30 * time.Second},
+			}},
+			want: []string{"-log_file", "/messages.json", "-format", "json", "-rate", "10", "-burst", "5",
+				"-repetitions", "3", "-jitter", "200ms", "-start_delay", "30s"},
+		},
+		{
+			name:      "empty emission",
+			simulator: loggingpipelineplumberv1beta1.SimulatorSpec{Emission: &loggingpipelineplumberv1beta1.EmissionSpec{}},
+			want:      []string{"-log_file", "/messages.json", "-format", "json"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			flowTest := loggingpipelineplumberv1beta1.FlowTest{}
+			flowTest.Spec.Simulator = tc.simulator
+			if got := simulatorArgs(flowTest); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mrsupiri/logging-pipeline-plumber/pkg/aggregator"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// NotificationReceiver listens for the log aggregator telling that a slice received its first records,
+// and queues the flowtest the slice belongs to so it doesn't have to wait for the next poll.
+// Notifications are signed with the ingestion key, unsigned ones could come from anywhere in the cluster.
+type NotificationReceiver struct {
+	Addr string
+	// AggregatorNamespace is where the ingestion key the notifications are signed with lives
+	AggregatorNamespace string
+	Client              client.Reader
+	Events              chan event.GenericEvent
+}
+
+// Start runs the receiver until the manager stops
+func (n *NotificationReceiver) Start(ctx context.Context) error {
+	logger := ctrl.Log.WithName("notification-receiver")
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/notifications", n)
+	server := &http.Server{Addr: n.Addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("starting notification receiver", "addr", n.Addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (n *NotificationReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := ctrl.Log.WithName("notification-receiver")
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the key is minted along with the first flowtest, there is no aggregator to hear from before that
+	var keySecret v1.Secret
+	if err := n.Client.Get(r.Context(), client.ObjectKey{Name: ingestionKeySecret, Namespace: n.AggregatorNamespace}, &keySecret); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			logger.Error(err, "failed to get the ingestion key")
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	signature := aggregator.NotificationSignature(keySecret.Data[ingestionKeyField], body)
+	if !hmac.Equal([]byte(r.Header.Get(aggregator.NotificationSignatureHeader)), []byte(signature)) {
+		logger.Info("dropped a notification with an invalid signature", "remote", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var notification aggregator.Notification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var flowTests loggingpipelineplumberv1beta1.FlowTestList
+	if err := n.Client.List(r.Context(), &flowTests); err != nil {
+		logger.Error(err, "failed to list flowtests")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// slices are named after the UID of their flowtest
+	for i := range flowTests.Items {
+		if !strings.HasPrefix(notification.Index, string(flowTests.Items[i].ObjectMeta.UID)) {
+			continue
+		}
+		logger.V(1).Info("slice received logs", "index", notification.Index, "flowtest", flowTests.Items[i].ObjectMeta.Name)
+		select {
+		case n.Events <- event.GenericEvent{Object: &flowTests.Items[i]}:
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		break
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
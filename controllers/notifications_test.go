@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mrsupiri/logging-pipeline-plumber/pkg/aggregator"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestNotificationReceiver(t *testing.T) {
+	key := []byte("ingestion-key")
+	body := `{"index":"uid-0-match"}`
+
+	for _, tc := range []struct {
+		name      string
+		signature string
+		noKey     bool
+		code      int
+	}{
+		{name: "signed", signature: aggregator.NotificationSignature(key, []byte(body)), code: http.StatusAccepted},
+		{name: "unsigned", code: http.StatusUnauthorized},
+		{name: "signed with another key", signature: aggregator.NotificationSignature([]byte("other"), []byte(body)), code: http.StatusUnauthorized},
+		{name: "no ingestion key yet", signature: aggregator.NotificationSignature(key, []byte(body)), noKey: true, code: http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			builder := fakeclient.NewClientBuilder().
+				WithScheme(testScheme(t)).
+				WithObjects(&loggingpipelineplumberv1beta1.FlowTest{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "uid"}})
+			if !tc.noKey {
+				builder = builder.WithObjects(&v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: ingestionKeySecret, Namespace: "plumber"},
+					Data:       map[string][]byte{ingestionKeyField: key},
+				})
+			}
+			receiver := &NotificationReceiver{AggregatorNamespace: "plumber", Client: builder.Build(), Events: make(chan event.GenericEvent, 1)}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/notifications", strings.NewReader(body))
+			if tc.signature != "" {
+				r.Header.Set(aggregator.NotificationSignatureHeader, tc.signature)
+			}
+			w := httptest.NewRecorder()
+			receiver.ServeHTTP(w, r)
+
+			if w.Code != tc.code {
+				t.Errorf("expected %d, got %d", tc.code, w.Code)
+			}
+			queued := len(receiver.Events) == 1
+			if queued != (tc.code == http.StatusAccepted) {
+				t.Errorf("expected the flowtest to be queued only for a verified notification, queued: %v", queued)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// matchCriteria is the part of a match probe that depends on where and how the simulation pod runs
+type matchCriteria struct {
+	// target is the key of the reference flow the match belongs to
+	target         string
+	match          int
+	hosts          []string
+	containerNames []string
+}
+
+// simulationPlacement describes how the simulation pod has to be scheduled so the match probes can be tested
+type simulationPlacement struct {
+	// nodeName is empty when none of the matches care about hosts
+	nodeName       string
+	containerNames []string
+	// untestable holds the reason for every match that can't be satisfied by the simulation pod,
+	// by the key of the reference flow and the index of the match
+	untestable map[string]map[int]string
+}
+
+func (r *FlowTestReconciler) referenceMatchCriteria(ctx context.Context, flowTest loggingpipelineplumberv1beta1.FlowTest) ([]matchCriteria, error) {
+	var criteria []matchCriteria
+
+	for _, target := range referenceTargets(&flowTest) {
+		if target.Kind == "ClusterFlow" {
+			referenceFlow, err := r.referenceClusterFlow(ctx, target)
+			if err != nil {
+				return nil, err
+			}
+			for i, match := range referenceFlow.Spec.Match {
+				c := matchCriteria{target: target.key, match: i}
+				if match.ClusterSelect != nil {
+					c.hosts, c.containerNames = match.ClusterSelect.Hosts, match.ClusterSelect.ContainerNames
+				} else if match.ClusterExclude != nil {
+					c.hosts, c.containerNames = match.ClusterExclude.Hosts, match.ClusterExclude.ContainerNames
+				}
+				criteria = append(criteria, c)
+			}
+		} else {
+			referenceFlow, err := r.referenceFlow(ctx, target)
+			if err != nil {
+				return nil, err
+			}
+			for i, match := range referenceFlow.Spec.Match {
+				c := matchCriteria{target: target.key, match: i}
+				if match.Select != nil {
+					c.hosts, c.containerNames = match.Select.Hosts, match.Select.ContainerNames
+				} else if match.Exclude != nil {
+					c.hosts, c.containerNames = match.Exclude.Hosts, match.Exclude.ContainerNames
+				}
+				criteria = append(criteria, c)
+			}
+		}
+	}
+
+	return criteria, nil
+}
+
+// placeSimulation picks the node and the container names of the simulation pod so that as many
+// match probes as possible can be tested, preferring the node the reference pod is running on
+func (r *FlowTestReconciler) placeSimulation(ctx context.Context, flowTest loggingpipelineplumberv1beta1.FlowTest, referencePod v1.Pod) (simulationPlacement, error) {
+	placement := simulationPlacement{untestable: map[string]map[int]string{}}
+
+	criteria, err := r.referenceMatchCriteria(ctx, flowTest)
+	if err != nil {
+		return placement, err
+	}
+
+	var nodes v1.NodeList
+	if err := r.List(ctx, &nodes); err != nil {
+		return placement, err
+	}
+
+	// score every node by the number of host restricted matches it satisfies
+	hostRestricted := 0
+	scores := map[string]int{}
+	for _, c := range criteria {
+		if len(c.hosts) == 0 {
+			continue
+		}
+		hostRestricted++
+		for _, node := range nodes.Items {
+			if contains(c.hosts, node.ObjectMeta.Name) {
+				scores[node.ObjectMeta.Name]++
+			}
+		}
+	}
+
+	if hostRestricted > 0 {
+		placement.nodeName = referencePod.Spec.NodeName
+		for _, node := range nodes.Items {
+			if scores[node.ObjectMeta.Name] > scores[placement.nodeName] {
+				placement.nodeName = node.ObjectMeta.Name
+			}
+		}
+		if scores[placement.nodeName] == 0 {
+			placement.nodeName = ""
+		}
+	}
+
+	for _, c := range criteria {
+		if len(c.hosts) == 0 || contains(c.hosts, placement.nodeName) {
+			continue
+		}
+		if placement.untestable[c.target] == nil {
+			placement.untestable[c.target] = map[int]string{}
+		}
+		known := false
+		for _, node := range nodes.Items {
+			known = known || contains(c.hosts, node.ObjectMeta.Name)
+		}
+		if known {
+			placement.untestable[c.target][c.match] = fmt.Sprintf("simulation pod runs on %s which is not one of the hosts %s", placement.nodeName, strings.Join(c.hosts, ", "))
+		} else {
+			placement.untestable[c.target][c.match] = fmt.Sprintf("none of the hosts %s are nodes of this cluster", strings.Join(c.hosts, ", "))
+		}
+	}
+
+	// add a container for every container_names restriction not already covered by an earlier one
+	for _, c := range criteria {
+		if _, ok := placement.untestable[c.target][c.match]; ok || len(c.containerNames) == 0 {
+			continue
+		}
+		covered := false
+		for _, name := range c.containerNames {
+			covered = covered || contains(placement.containerNames, name)
+		}
+		if !covered {
+			placement.containerNames = append(placement.containerNames, c.containerNames[0])
+		}
+	}
+
+	if len(placement.containerNames) == 0 {
+		// TODO: Handle more than or less than 1 Container (#12)
+		placement.containerNames = []string{referencePod.Spec.Containers[0].Name}
+	}
+
+	return placement, nil
+}
+
+// untestableMatchResults starts the match results of a reference flow, the testable matches are NotMatched
+// until their probes receive logs
+func untestableMatchResults(matchCount int, untestable map[int]string) []loggingpipelineplumberv1beta1.MatchResult {
+	if len(untestable) == 0 {
+		return nil
+	}
+	results := make([]loggingpipelineplumberv1beta1.MatchResult, matchCount)
+	for i := range results {
+		results[i].Outcome = loggingpipelineplumberv1beta1.NotMatched
+	}
+	for i, reason := range untestable {
+		results[i] = loggingpipelineplumberv1beta1.MatchResult{
+			Outcome: loggingpipelineplumberv1beta1.Untestable,
+			Message: reason,
+		}
+	}
+	return results
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestUntestableMatchResults(t *testing.T) {
+	if results := untestableMatchResults(2, nil); results != nil {
+		t.Errorf("expected no results without untestable matches, got %v", results)
+	}
+
+	results := untestableMatchResults(3, map[int]string{1: "hosts"})
+	want := []loggingpipelineplumberv1beta1.MatchResult{
+		{Outcome: loggingpipelineplumberv1beta1.NotMatched},
+		{Outcome: loggingpipelineplumberv1beta1.Untestable, Message: "hosts"},
+		{Outcome: loggingpipelineplumberv1beta1.NotMatched},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("expected %v, got %v", want, results)
+	}
+
+	// the outcome is required by the CRD, an empty one gets the status update rejected
+	valid := map[loggingpipelineplumberv1beta1.MatchOutcome]bool{
+		loggingpipelineplumberv1beta1.Selected: true, loggingpipelineplumberv1beta1.Excluded: true,
+		loggingpipelineplumberv1beta1.NotMatched: true, loggingpipelineplumberv1beta1.NotReached: true,
+		loggingpipelineplumberv1beta1.Untestable: true,
+	}
+	for i, result := range results {
+		if !valid[result.Outcome] {
+			t.Errorf("match #%d has the invalid outcome %q", i, result.Outcome)
+		}
+	}
+}
+
+func TestMatchResults(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		excludes    []bool
+		matchStatus []bool
+		previous    []loggingpipelineplumberv1beta1.MatchResult
+		want        []loggingpipelineplumberv1beta1.MatchOutcome
+	}{
+		{
+			name:        "first select decides",
+			excludes:    []bool{false, false},
+			matchStatus: []bool{true, true},
+			want:        []loggingpipelineplumberv1beta1.MatchOutcome{loggingpipelineplumberv1beta1.Selected, loggingpipelineplumberv1beta1.NotReached},
+		},
+		{
+			name:        "exclude then select",
+			excludes:    []bool{true, false},
+			matchStatus: []bool{false, true},
+			want:        []loggingpipelineplumberv1beta1.MatchOutcome{loggingpipelineplumberv1beta1.NotMatched, loggingpipelineplumberv1beta1.Selected},
+		},
+		{
+			name:        "exclude decides",
+			excludes:    []bool{true, false},
+			matchStatus: []bool{true, true},
+			want:        []loggingpipelineplumberv1beta1.MatchOutcome{loggingpipelineplumberv1beta1.Excluded, loggingpipelineplumberv1beta1.NotReached},
+		},
+		{
+			name:        "untestable is kept",
+			excludes:    []bool{false, false},
+			matchStatus: []bool{false, true},
+			previous:    untestableMatchResults(2, map[int]string{0: "hosts"}),
+			want:        []loggingpipelineplumberv1beta1.MatchOutcome{loggingpipelineplumberv1beta1.Untestable, loggingpipelineplumberv1beta1.Selected},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			results := matchResults(tc.excludes, tc.matchStatus, tc.previous)
+			var got []loggingpipelineplumberv1beta1.MatchOutcome
+			for _, result := range results {
+				got = append(got, result.Outcome)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPlaceSimulation(t *testing.T) {
+	node := func(name string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	referencePod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: v1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []v1.Container{{Name: "app"}},
+		},
+	}
+
+	for _, tc := range []struct {
+		name           string
+		matches        []flowv1beta1.Match
+		nodeName       string
+		containerNames []string
+		untestable     map[int]string
+	}{
+		{
+			name:           "labels only",
+			matches:        []flowv1beta1.Match{{Select: &flowv1beta1.Select{Labels: map[string]string{"app": "a"}}}},
+			containerNames: []string{"app"},
+		},
+		{
+			name:           "hosts move the pod",
+			matches:        []flowv1beta1.Match{{Select: &flowv1beta1.Select{Hosts: []string{"node-2"}}}},
+			nodeName:       "node-2",
+			containerNames: []string{"app"},
+		},
+		{
+			name: "reference node wins a tie",
+			matches: []flowv1beta1.Match{
+				{Select: &flowv1beta1.Select{Hosts: []string{"node-2"}}},
+				{Exclude: &flowv1beta1.Exclude{Hosts: []string{"node-1"}}},
+			},
+			nodeName:       "node-1",
+			containerNames: []string{"app"},
+			untestable:     map[int]string{0: "simulation pod runs on node-1"},
+		},
+		{
+			name:           "unknown hosts",
+			matches:        []flowv1beta1.Match{{Select: &flowv1beta1.Select{Hosts: []string{"gone"}}}},
+			containerNames: []string{"app"},
+			untestable:     map[int]string{0: "none of the hosts gone"},
+		},
+		{
+			name: "container names",
+			matches: []flowv1beta1.Match{
+				{Select: &flowv1beta1.Select{ContainerNames: []string{"web", "api"}}},
+				{Select: &flowv1beta1.Select{ContainerNames: []string{"api"}}},
+				{Exclude: &flowv1beta1.Exclude{ContainerNames: []string{"web"}}},
+			},
+			containerNames: []string{"web", "api"},
+		},
+		{
+			name: "container names of untestable matches are skipped",
+			matches: []flowv1beta1.Match{
+				{Select: &flowv1beta1.Select{Hosts: []string{"gone"}, ContainerNames: []string{"web"}}},
+			},
+			containerNames: []string{"app"},
+			untestable:     map[int]string{0: "none of the hosts gone"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			kubeClient := fakeclient.NewClientBuilder().
+				WithScheme(clientgoscheme.Scheme).
+				WithObjects(node("node-1"), node("node-2")).
+				Build()
+			r := &FlowTestReconciler{Client: kubeClient}
+			flowTest := loggingpipelineplumberv1beta1.FlowTest{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec: loggingpipelineplumberv1beta1.FlowTestSpec{
+					ReferencePod: loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Pod", Name: "app", Namespace: "default"},
+					InlineFlow:   &flowv1beta1.FlowSpec{Match: tc.matches},
+				},
+			}
+
+			placement, err := r.placeSimulation(context.Background(), flowTest, referencePod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if placement.nodeName != tc.nodeName {
+				t.Errorf("expected node %q, got %q", tc.nodeName, placement.nodeName)
+			}
+			if !reflect.DeepEqual(placement.containerNames, tc.containerNames) {
+				t.Errorf("expected containers %v, got %v", tc.containerNames, placement.containerNames)
+			}
+			untestable := placement.untestable[primaryReference]
+			if len(untestable) != len(tc.untestable) {
+				t.Fatalf("expected untestable matches %v, got %v", tc.untestable, untestable)
+			}
+			for i, reason := range tc.untestable {
+				if !strings.HasPrefix(untestable[i], reason) {
+					t.Errorf("expected match #%d to be untestable because %q, got %q", i, reason, untestable[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMirrorReferencePod(t *testing.T) {
+	referencePod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "app",
+			Annotations: map[string]string{
+				"team":                              "logging",
+				"kubectl.kubernetes.io/restartedAt": "now",
+				"secret":                            "value",
+			},
+		},
+		Spec: v1.PodSpec{
+			Containers:        []v1.Container{{Name: "app", Image: "app:1"}},
+			Tolerations:       []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpExists}},
+			PriorityClassName: "high",
+		},
+	}
+	simulationPod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "uid-simulation"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "app", Image: "pod-simulator:1"}, {Name: "web", Image: "pod-simulator:1"}},
+		},
+	}
+
+	unreproduced := mirrorReferencePod(&simulationPod, referencePod, []string{"kubectl.kubernetes.io/*", "secret"})
+
+	if !reflect.DeepEqual(simulationPod.ObjectMeta.Annotations, map[string]string{"team": "logging"}) {
+		t.Errorf("expected only the allowed annotations to be copied, got %v", simulationPod.ObjectMeta.Annotations)
+	}
+	if !reflect.DeepEqual(simulationPod.Spec.Tolerations, referencePod.Spec.Tolerations) || simulationPod.Spec.PriorityClassName != "high" {
+		t.Errorf("expected the scheduling constraints to be copied, got %+v", simulationPod.Spec)
+	}
+
+	var fields []string
+	for _, metadata := range unreproduced {
+		fields = append(fields, metadata.Field)
+	}
+	want := []string{
+		"kubernetes.annotations.kubectl.kubernetes.io/restartedAt",
+		"kubernetes.annotations.secret",
+		"kubernetes.container_image",
+		"kubernetes.container_name",
+		"kubernetes.pod_name",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("expected unreproduced metadata %v, got %v", want, fields)
+	}
+}
@@ -1,14 +1,17 @@
 package controllers
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 
 	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
 	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -20,9 +23,24 @@ func (r *FlowTestReconciler) provisionResource(ctx context.Context) error {
 	logger := log.FromContext(ctx)
 	flowTest := ctx.Value("flowTest").(loggingpipelineplumberv1beta1.FlowTest)
 
-	logOutput := new(bytes.Buffer)
-	for _, line := range flowTest.Spec.SentMessages {
-		_, _ = logOutput.WriteString(fmt.Sprintf("%s\n", line))
+	if err := validateReferences(flowTest); err != nil {
+		return err
+	}
+	if err := validateFaults(flowTest); err != nil {
+		return err
+	}
+	if err := validateSentMessages(flowTest); err != nil {
+		return err
+	}
+	if err := validateOutputProtocol(flowTest); err != nil {
+		return err
+	}
+
+	// the messages are passed as they are, the simulator serializes the objects as single-line JSON
+	messages, err := json.Marshal(flowTest.Spec.SentMessages)
+	if err != nil {
+		logger.Error(err, "failed to encode the sent messages")
+		return err
 	}
 
 	Immutable := true
@@ -37,15 +55,15 @@ func (r *FlowTestReconciler) provisionResource(ctx context.Context) error {
 			Labels:    GetLabels("pod-simulation", &flowTest),
 		},
 		Immutable:  &Immutable,
-		BinaryData: map[string][]byte{"simulation.log": logOutput.Bytes()},
+		BinaryData: map[string][]byte{"messages.json": messages},
 	}
 
 	if err := r.Create(ctx, &configMap); err != nil {
-		logger.Error(err, "failed to create ConfigMap with simulation.log")
+		logger.Error(err, "failed to create ConfigMap with messages.json")
 		return err
 	}
 
-	logger.V(1).Info("deployed config map with simulation.log", "uuid", configMap.ObjectMeta.UID)
+	logger.V(1).Info("deployed config map with messages.json", "uuid", configMap.ObjectMeta.UID)
 
 	var referencePod v1.Pod
 	if err := r.Get(ctx, types.NamespacedName{
@@ -55,6 +73,12 @@ func (r *FlowTestReconciler) provisionResource(ctx context.Context) error {
 		return err
 	}
 
+	placement, err := r.placeSimulation(ctx, flowTest, referencePod)
+	if err != nil {
+		logger.Error(err, "failed to place the simulation pod")
+		return err
+	}
+
 	simulationPod := v1.Pod{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "V1",
@@ -66,15 +90,6 @@ func (r *FlowTestReconciler) provisionResource(ctx context.Context) error {
 			Labels:    map[string]string{},
 		},
 		Spec: v1.PodSpec{
-			Containers: []v1.Container{{
-				// TODO: Handle more than or less than 1 Container (#12)
-				Name:            referencePod.Spec.Containers[0].Name,
-				Image:           fmt.Sprintf("%s:%s", r.PodSimulatorImage.Repository, r.PodSimulatorImage.Tag),
-				ImagePullPolicy: v1.PullPolicy(r.PodSimulatorImage.PullPolicy),
-				Command:         []string{"pod-simulator"},
-				Args:            []string{"-log_file", "/simulation.log"},
-				VolumeMounts:    []v1.VolumeMount{{Name: "config-volume", MountPath: "/simulation.log", SubPath: "simulation.log"}},
-			}},
 			Volumes: []v1.Volume{
 				{
 					Name: "config-volume",
@@ -89,6 +104,17 @@ func (r *FlowTestReconciler) provisionResource(ctx context.Context) error {
 		},
 	}
 
+	for _, name := range placement.containerNames {
+		simulationPod.Spec.Containers = append(simulationPod.Spec.Containers, v1.Container{
+			Name:            name,
+			Image:           fmt.Sprintf("%s:%s", r.PodSimulatorImage.Repository, r.PodSimulatorImage.Tag),
+			ImagePullPolicy: v1.PullPolicy(r.PodSimulatorImage.PullPolicy),
+			Command:         []string{"pod-simulator"},
+			Args:            simulatorArgs(flowTest),
+			VolumeMounts:    []v1.VolumeMount{{Name: "config-volume", MountPath: "/messages.json", SubPath: "messages.json"}},
+		})
+	}
+
 	extraLabels := GetLabels("pod-simulation", &flowTest)
 
 	if referencePod.ObjectMeta.Labels != nil {
@@ -101,6 +127,35 @@ func (r *FlowTestReconciler) provisionResource(ctx context.Context) error {
 		simulationPod.ObjectMeta.Labels[k] = v
 	}
 
+	flowTest.Status.UnreproducedMetadata = mirrorReferencePod(&simulationPod, referencePod, r.AnnotationDenylist)
+
+	nodeName := placement.nodeName
+	if nodeName == "" && flowTest.Spec.Simulator.MirrorNode {
+		nodeName = referencePod.Spec.NodeName
+	}
+	switch {
+	case nodeName == "":
+		flowTest.Status.UnreproducedMetadata = append(flowTest.Status.UnreproducedMetadata, loggingpipelineplumberv1beta1.UnreproducedMetadata{
+			Field:  "kubernetes.host",
+			Reason: fmt.Sprintf("simulation pod is scheduled on its own, set spec.simulator.mirrorNode to pin it to %s", referencePod.Spec.NodeName),
+		})
+	case nodeName != referencePod.Spec.NodeName:
+		flowTest.Status.UnreproducedMetadata = append(flowTest.Status.UnreproducedMetadata, loggingpipelineplumberv1beta1.UnreproducedMetadata{
+			Field:  "kubernetes.host",
+			Reason: fmt.Sprintf("simulation pod is pinned to %s instead of %s to satisfy hosts matches", nodeName, referencePod.Spec.NodeName),
+		})
+	}
+
+	var podTemplate []byte
+	if flowTest.Spec.Simulator.PodTemplate != nil {
+		podTemplate = flowTest.Spec.Simulator.PodTemplate.Raw
+	}
+	// manager wide defaults go first so the flowtest can override them
+	if err := scheduleSimulationPod(&simulationPod, nodeName, r.SimulatorPodTemplate, podTemplate); err != nil {
+		logger.Error(err, "failed to apply the simulator pod template")
+		return err
+	}
+
 	if err := r.Create(ctx, &simulationPod); err != nil {
 		logger.Error(err, "failed to create the simulation pod")
 		return err
@@ -112,10 +167,15 @@ func (r *FlowTestReconciler) provisionResource(ctx context.Context) error {
 		return err
 	}
 
-	if err := r.deploySlicedFlows(ctx, extraLabels, &flowTest); err != nil {
+	if err := r.deploySlicedFlows(ctx, extraLabels, placement.untestable, &flowTest); err != nil {
 		return err
 	}
 
+	// the aggregator may still be starting, the faults are set again on every check
+	if err := r.configureFaults(ctx, flowTest); err != nil {
+		logger.V(1).Info("faults will be configured on the next check", "reason", err.Error())
+	}
+
 	flowTest.Status.Status = loggingpipelineplumberv1beta1.Running
 
 	if err := r.Status().Update(ctx, &flowTest); err != nil {
@@ -126,215 +186,401 @@ func (r *FlowTestReconciler) provisionResource(ctx context.Context) error {
 	return nil
 }
 
-func (r *FlowTestReconciler) deploySlicedFlows(ctx context.Context, extraLabels map[string]string, flowTest *loggingpipelineplumberv1beta1.FlowTest) (err error) {
+func (r *FlowTestReconciler) deploySlicedFlows(ctx context.Context, extraLabels map[string]string, untestable map[string]map[int]string, flowTest *loggingpipelineplumberv1beta1.FlowTest) error {
+	targets := referenceTargets(flowTest)
+	initMessageComparisons(flowTest)
+	for _, target := range targets {
+		if err := r.deployReferenceSlices(ctx, extraLabels, untestable[target.key], flowTest, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployReferenceSlices slices a single reference flow, the simulation pod is shared by all of them
+func (r *FlowTestReconciler) deployReferenceSlices(ctx context.Context, extraLabels map[string]string, untestable map[int]string, flowTest *loggingpipelineplumberv1beta1.FlowTest, target referenceTarget) (err error) {
 	logger := log.FromContext(ctx)
 
 	// TODO: handle this sane way
-	if flowTest.Spec.ReferenceFlow.Kind == "ClusterFlow" {
+	if target.Kind == "ClusterFlow" {
 		var referenceFlow flowv1beta1.ClusterFlow
-		if err = r.Get(ctx, types.NamespacedName{
-			Namespace: flowTest.Spec.ReferenceFlow.Namespace,
-			Name:      flowTest.Spec.ReferenceFlow.Name,
-		}, &referenceFlow); err != nil {
+		if referenceFlow, err = r.referenceClusterFlow(ctx, target); err != nil {
 			return
 		}
 
-		flowTest.Status.MatchStatus = make([]bool, len(referenceFlow.Spec.Match))
-		flowTest.Status.FilterStatus = make([]bool, len(referenceFlow.Spec.Filters))
-
-		i := 0
-		flowTemplate, outTemplate := r.clusterFlowTemplates(referenceFlow, *flowTest)
-		for x := 0; x <= len(referenceFlow.Spec.Match)-1; x++ {
-			targetFlow := *flowTemplate.DeepCopy()
-			targetOutput := *outTemplate.DeepCopy()
-
-			targetFlow.ObjectMeta.Name = fmt.Sprintf("%s-%d-match", flowTest.ObjectMeta.UID, i)
-			targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", i)
-			targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = "match"
+		target.results.MatchStatus = make([]bool, len(referenceFlow.Spec.Match))
+		target.results.MatchResults = untestableMatchResults(len(referenceFlow.Spec.Match), untestable)
 
-			targetOutput.ObjectMeta.Name = fmt.Sprintf("%s-%d-match", flowTest.ObjectMeta.UID, i)
-			targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", i)
-			targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = "match"
-			targetOutput.Spec.HTTPOutput.Endpoint = fmt.Sprintf("%s/%s/", targetOutput.Spec.HTTPOutput.Endpoint, targetFlow.ObjectMeta.Name)
+		var logging *flowv1beta1.Logging
+		if logging, err = r.referenceLogging(ctx, referenceFlow.Spec.LoggingRef, referenceFlow.ObjectMeta.Namespace, true); err != nil {
+			return
+		}
+		target.results.Logging = logging.ObjectMeta.Name
 
-			targetFlow.Spec.GlobalOutputRefs = []string{targetOutput.ObjectMeta.Name}
+		if target.results.DestinationHealth, err = r.destinationHealth(ctx, referenceFlow.ObjectMeta.Namespace, referenceFlow.Spec.LoggingRef, true, nil,
+			append(referenceFlow.Spec.GlobalOutputRefs, referenceFlow.Spec.OutputRefs...)); err != nil {
+			return
+		}
 
-			targetFlow.Spec.Match = []flowv1beta1.ClusterMatch{referenceFlow.Spec.Match[x]}
+		if err = r.provisionIngestionSecret(ctx, *flowTest, referenceFlow.ObjectMeta.Namespace); err != nil {
+			return
+		}
 
-			if err = r.Create(ctx, &targetOutput); err != nil {
-				logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
-				return
+		i := 0
+		flowTemplate, outTemplate := r.clusterFlowTemplates(referenceFlow, *flowTest)
+		flowTemplate.ObjectMeta.Labels["loggingpipelineplumber.isala.me/reference-flow"] = target.key
+		outTemplate.ObjectMeta.Labels["loggingpipelineplumber.isala.me/reference-flow"] = target.key
+		for x := 0; x <= len(referenceFlow.Spec.Match)-1; x++ {
+			if reason, ok := untestable[x]; ok {
+				logger.V(1).Info("skipped untestable match slice", "test-id", i, "reason", reason)
+				i++
+				continue
 			}
-
-			if err = r.Create(ctx, &targetFlow); err != nil {
+			name := target.sliceName(*flowTest, i, "match")
+			match := clusterMatchProbe(referenceFlow.Spec.Match, x)
+			if err = r.deployClusterFlowSlice(ctx, flowTemplate, outTemplate, name, "match", i, match, nil); err != nil {
 				logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
 				return
 			}
-
 			logger.V(1).Info("deployed match slice", "test-id", i)
 			i++
 		}
 
-		for x := 1; x <= len(referenceFlow.Spec.Filters); x++ {
-			targetFlow := *flowTemplate.DeepCopy()
-			targetOutput := *outTemplate.DeepCopy()
-
-			targetFlow.ObjectMeta.Name = fmt.Sprintf("%s-%d-filture", flowTest.ObjectMeta.UID, i)
-			targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = "filter"
-			targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", i)
-
-			targetOutput.ObjectMeta.Name = fmt.Sprintf("%s-%d-filture", flowTest.ObjectMeta.UID, i)
-			targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = "filter"
-			targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", i)
-			targetOutput.Spec.HTTPOutput.Endpoint = fmt.Sprintf("%s/%s/", targetOutput.Spec.HTTPOutput.Endpoint, targetFlow.ObjectMeta.Name)
-
-			targetFlow.Spec.GlobalOutputRefs = []string{targetOutput.ObjectMeta.Name}
-
-			// ensure logs are only coming from our simulation pod
-			targetFlow.Spec.Match = []flowv1beta1.ClusterMatch{{
-				ClusterSelect: &flowv1beta1.ClusterSelect{Labels: extraLabels},
-			}}
-
-			targetFlow.Spec.Filters = append(targetFlow.Spec.Filters, referenceFlow.Spec.Filters[:x]...)
+		// ensure logs are only coming from our simulation pod
+		match := []flowv1beta1.ClusterMatch{{
+			ClusterSelect: &flowv1beta1.ClusterSelect{Labels: extraLabels},
+		}}
+
+		if slicingModeEnabled(flowTest, loggingpipelineplumberv1beta1.Cumulative) {
+			target.results.FilterStatus = make([]bool, len(referenceFlow.Spec.Filters))
+			for x := 1; x <= len(referenceFlow.Spec.Filters); x++ {
+				name := target.sliceName(*flowTest, i, "filture")
+				if err = r.deployClusterFlowSlice(ctx, flowTemplate, outTemplate, name, "filter", i, match, referenceFlow.Spec.Filters[:x]); err != nil {
+					logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
+					return
+				}
+				logger.V(1).Info("deployed filter slice", "test-id", i)
+				i++
+			}
+		}
 
-			if err = r.Create(ctx, &targetOutput); err != nil {
-				logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
-				return
+		if slicingModeEnabled(flowTest, loggingpipelineplumberv1beta1.Isolated) {
+			target.results.IsolatedFilterStatus = make([]bool, len(referenceFlow.Spec.Filters))
+			for x := 0; x <= len(referenceFlow.Spec.Filters)-1; x++ {
+				name := target.sliceName(*flowTest, i, "isolated")
+				if err = r.deployClusterFlowSlice(ctx, flowTemplate, outTemplate, name, "isolated-filter", i, match, referenceFlow.Spec.Filters[x:x+1]); err != nil {
+					logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
+					return
+				}
+				logger.V(1).Info("deployed isolated filter slice", "test-id", i)
+				i++
 			}
+		}
 
-			if err = r.Create(ctx, &targetFlow); err != nil {
-				logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
-				return
+		// run the reference flow as a whole, per slice results can pass while the full pipeline fails
+		pipelineStatus := false
+		target.results.PipelineStatus = &pipelineStatus
+		name := target.sliceName(*flowTest, i, "pipeline")
+		if err = r.deployClusterFlowSlice(ctx, flowTemplate, outTemplate, name, "pipeline", i, referenceFlow.Spec.Match, referenceFlow.Spec.Filters); err != nil {
+			logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
+			return
+		}
+		logger.V(1).Info("deployed full pipeline slice", "test-id", i)
+
+		// one full pipeline per sent message, so the baseline and the candidate can be compared message by message
+		if comparing(flowTest, target) {
+			for m := range flowTest.Spec.SentMessages {
+				name := target.sliceName(*flowTest, m, "message")
+				messageFilters := append([]flowv1beta1.Filter{messageGuard(flowTest, m)}, referenceFlow.Spec.Filters...)
+				if err = r.deployClusterFlowSlice(ctx, flowTemplate, outTemplate, name, "message", m, referenceFlow.Spec.Match, messageFilters); err != nil {
+					logger.Error(err, fmt.Sprintf("failed to deploy message slice #%d for %s", m, referenceFlow.ObjectMeta.Name))
+					return
+				}
+				logger.V(1).Info("deployed message slice", "test-id", m)
 			}
-			logger.V(1).Info("deployed filter slice", "test-id", i)
-			i++
 		}
 
 	} else {
 		var referenceFlow flowv1beta1.Flow
-		if err = r.Get(ctx, types.NamespacedName{
-			Namespace: flowTest.Spec.ReferenceFlow.Namespace,
-			Name:      flowTest.Spec.ReferenceFlow.Name,
-		}, &referenceFlow); err != nil {
+		if referenceFlow, err = r.referenceFlow(ctx, target); err != nil {
 			return
 		}
 
-		flowTest.Status.MatchStatus = make([]bool, len(referenceFlow.Spec.Match))
-		flowTest.Status.FilterStatus = make([]bool, len(referenceFlow.Spec.Filters))
+		target.results.MatchStatus = make([]bool, len(referenceFlow.Spec.Match))
+		target.results.MatchResults = untestableMatchResults(len(referenceFlow.Spec.Match), untestable)
 
-		i := 0
-		flowTemplate, outTemplate := r.flowTemplates(referenceFlow, *flowTest)
-
-		for x := 0; x <= len(referenceFlow.Spec.Match)-1; x++ {
-			targetFlow := *flowTemplate.DeepCopy()
-			targetOutput := *outTemplate.DeepCopy()
-
-			targetFlow.ObjectMeta.Name = fmt.Sprintf("%s-%d-match", flowTest.ObjectMeta.UID, i)
-			targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", i)
-			targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = "match"
+		var logging *flowv1beta1.Logging
+		if logging, err = r.referenceLogging(ctx, referenceFlow.Spec.LoggingRef, referenceFlow.ObjectMeta.Namespace, false); err != nil {
+			return
+		}
+		target.results.Logging = logging.ObjectMeta.Name
 
-			targetOutput.ObjectMeta.Name = fmt.Sprintf("%s-%d-match", flowTest.ObjectMeta.UID, i)
-			targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", i)
-			targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = "match"
-			targetOutput.Spec.HTTPOutput.Endpoint = fmt.Sprintf("%s/%s/", targetOutput.Spec.HTTPOutput.Endpoint, targetFlow.ObjectMeta.Name)
+		if target.results.DestinationHealth, err = r.destinationHealth(ctx, referenceFlow.ObjectMeta.Namespace, referenceFlow.Spec.LoggingRef, false,
+			append(referenceFlow.Spec.LocalOutputRefs, referenceFlow.Spec.OutputRefs...), referenceFlow.Spec.GlobalOutputRefs); err != nil {
+			return
+		}
 
-			targetFlow.Spec.LocalOutputRefs = []string{targetOutput.ObjectMeta.Name}
+		if err = r.provisionIngestionSecret(ctx, *flowTest, referenceFlow.ObjectMeta.Namespace); err != nil {
+			return
+		}
 
-			targetFlow.Spec.Match = []flowv1beta1.Match{referenceFlow.Spec.Match[x]}
+		i := 0
+		flowTemplate, outTemplate := r.flowTemplates(referenceFlow, *flowTest)
+		flowTemplate.ObjectMeta.Labels["loggingpipelineplumber.isala.me/reference-flow"] = target.key
+		outTemplate.ObjectMeta.Labels["loggingpipelineplumber.isala.me/reference-flow"] = target.key
 
-			if err = r.Create(ctx, &targetOutput); err != nil {
-				logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
-				return
+		for x := 0; x <= len(referenceFlow.Spec.Match)-1; x++ {
+			if reason, ok := untestable[x]; ok {
+				logger.V(1).Info("skipped untestable match slice", "test-id", i, "reason", reason)
+				i++
+				continue
 			}
-
-			if err = r.Create(ctx, &targetFlow); err != nil {
+			name := target.sliceName(*flowTest, i, "match")
+			match := matchProbe(referenceFlow.Spec.Match, x)
+			if err = r.deployFlowSlice(ctx, flowTemplate, outTemplate, name, "match", i, match, nil); err != nil {
 				logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
 				return
 			}
-
 			logger.V(1).Info("deployed match slice", "test-id", i)
 			i++
 		}
 
-		for x := 1; x <= len(referenceFlow.Spec.Filters); x++ {
-			targetFlow := *flowTemplate.DeepCopy()
-			targetOutput := *outTemplate.DeepCopy()
+		// ensure logs are only coming from our simulation pod
+		match := []flowv1beta1.Match{{
+			Select: &flowv1beta1.Select{Labels: extraLabels},
+		}}
+
+		if slicingModeEnabled(flowTest, loggingpipelineplumberv1beta1.Cumulative) {
+			target.results.FilterStatus = make([]bool, len(referenceFlow.Spec.Filters))
+			for x := 1; x <= len(referenceFlow.Spec.Filters); x++ {
+				name := target.sliceName(*flowTest, i, "filture")
+				if err = r.deployFlowSlice(ctx, flowTemplate, outTemplate, name, "filter", i, match, referenceFlow.Spec.Filters[:x]); err != nil {
+					logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
+					return
+				}
+				logger.V(1).Info("deployed filter slice", "test-id", i)
+				i++
+			}
+		}
 
-			targetFlow.ObjectMeta.Name = fmt.Sprintf("%s-%d-filture", flowTest.ObjectMeta.UID, i)
-			targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = "filter"
-			targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", i)
+		if slicingModeEnabled(flowTest, loggingpipelineplumberv1beta1.Isolated) {
+			target.results.IsolatedFilterStatus = make([]bool, len(referenceFlow.Spec.Filters))
+			for x := 0; x <= len(referenceFlow.Spec.Filters)-1; x++ {
+				name := target.sliceName(*flowTest, i, "isolated")
+				if err = r.deployFlowSlice(ctx, flowTemplate, outTemplate, name, "isolated-filter", i, match, referenceFlow.Spec.Filters[x:x+1]); err != nil {
+					logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
+					return
+				}
+				logger.V(1).Info("deployed isolated filter slice", "test-id", i)
+				i++
+			}
+		}
 
-			targetOutput.ObjectMeta.Name = fmt.Sprintf("%s-%d-filture", flowTest.ObjectMeta.UID, i)
-			targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = "filter"
-			targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", i)
-			targetOutput.Spec.HTTPOutput.Endpoint = fmt.Sprintf("%s/%s/", targetOutput.Spec.HTTPOutput.Endpoint, targetFlow.ObjectMeta.Name)
+		// run the reference flow as a whole, per slice results can pass while the full pipeline fails
+		pipelineStatus := false
+		target.results.PipelineStatus = &pipelineStatus
+		name := target.sliceName(*flowTest, i, "pipeline")
+		if err = r.deployFlowSlice(ctx, flowTemplate, outTemplate, name, "pipeline", i, referenceFlow.Spec.Match, referenceFlow.Spec.Filters); err != nil {
+			logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
+			return
+		}
+		logger.V(1).Info("deployed full pipeline slice", "test-id", i)
+
+		// one full pipeline per sent message, so the baseline and the candidate can be compared message by message
+		if comparing(flowTest, target) {
+			for m := range flowTest.Spec.SentMessages {
+				name := target.sliceName(*flowTest, m, "message")
+				messageFilters := append([]flowv1beta1.Filter{messageGuard(flowTest, m)}, referenceFlow.Spec.Filters...)
+				if err = r.deployFlowSlice(ctx, flowTemplate, outTemplate, name, "message", m, referenceFlow.Spec.Match, messageFilters); err != nil {
+					logger.Error(err, fmt.Sprintf("failed to deploy message slice #%d for %s", m, referenceFlow.ObjectMeta.Name))
+					return
+				}
+				logger.V(1).Info("deployed message slice", "test-id", m)
+			}
+		}
+	}
 
-			targetFlow.Spec.LocalOutputRefs = []string{targetOutput.ObjectMeta.Name}
+	return
+}
 
-			// ensure logs are only coming from our simulation pod
-			targetFlow.Spec.Match = []flowv1beta1.Match{{
-				Select: &flowv1beta1.Select{Labels: extraLabels},
-			}}
+// deployFlowSlice creates a Flow with the given matches and filters along with an Output
+// that ships everything the Flow lets through to the log aggregator index of the same name
+func (r *FlowTestReconciler) deployFlowSlice(ctx context.Context, flowTemplate flowv1beta1.Flow, outTemplate flowv1beta1.Output, name string, testType string, testID int, match []flowv1beta1.Match, filters []flowv1beta1.Filter) error {
+	targetFlow := *flowTemplate.DeepCopy()
+	targetOutput := *outTemplate.DeepCopy()
+
+	targetFlow.ObjectMeta.Name = name
+	targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", testID)
+	targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = testType
+
+	targetOutput.ObjectMeta.Name = name
+	targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", testID)
+	targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = testType
+	tagFilters := sliceOutput(&targetOutput.Spec, name)
+	if faultApplies(ctx.Value("flowTest").(loggingpipelineplumberv1beta1.FlowTest), testType) {
+		tagFilters = append([]flowv1beta1.Filter{eventTimeFilter()}, tagFilters...)
+	}
 
-			targetFlow.Spec.Filters = append(targetFlow.Spec.Filters, referenceFlow.Spec.Filters[:x]...)
+	targetFlow.Spec.LocalOutputRefs = []string{targetOutput.ObjectMeta.Name}
+	targetFlow.Spec.Match = match
+	targetFlow.Spec.Filters = append(append(targetFlow.Spec.Filters, filters...), tagFilters...)
 
-			if err = r.Create(ctx, &targetOutput); err != nil {
-				logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
-				return
-			}
+	if err := r.Create(ctx, &targetOutput); err != nil {
+		return err
+	}
+	return r.Create(ctx, &targetFlow)
+}
 
-			if err = r.Create(ctx, &targetFlow); err != nil {
-				logger.Error(err, fmt.Sprintf("failed to deploy Flow #%d for %s", i, referenceFlow.ObjectMeta.Name))
-				return
-			}
-			logger.V(1).Info("deployed filter slice", "test-id", i)
-			i++
-		}
+// deployClusterFlowSlice is the ClusterFlow counterpart of deployFlowSlice
+func (r *FlowTestReconciler) deployClusterFlowSlice(ctx context.Context, flowTemplate flowv1beta1.ClusterFlow, outTemplate flowv1beta1.ClusterOutput, name string, testType string, testID int, match []flowv1beta1.ClusterMatch, filters []flowv1beta1.Filter) error {
+	targetFlow := *flowTemplate.DeepCopy()
+	targetOutput := *outTemplate.DeepCopy()
+
+	targetFlow.ObjectMeta.Name = name
+	targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", testID)
+	targetFlow.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = testType
+
+	targetOutput.ObjectMeta.Name = name
+	targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-id"] = fmt.Sprintf("%d", testID)
+	targetOutput.ObjectMeta.Labels["loggingpipelineplumber.isala.me/test-type"] = testType
+	tagFilters := sliceOutput(&targetOutput.Spec.OutputSpec, name)
+	if faultApplies(ctx.Value("flowTest").(loggingpipelineplumberv1beta1.FlowTest), testType) {
+		tagFilters = append([]flowv1beta1.Filter{eventTimeFilter()}, tagFilters...)
 	}
 
-	return
+	targetFlow.Spec.GlobalOutputRefs = []string{targetOutput.ObjectMeta.Name}
+	targetFlow.Spec.Match = match
+	targetFlow.Spec.Filters = append(append(targetFlow.Spec.Filters, filters...), tagFilters...)
+
+	if err := r.Create(ctx, &targetOutput); err != nil {
+		return err
+	}
+	return r.Create(ctx, &targetFlow)
 }
 
 func (r *FlowTestReconciler) provisionOutputResource(ctx context.Context) error {
 	logger := log.FromContext(ctx)
-	flowTest := ctx.Value("flowTest").(loggingpipelineplumberv1beta1.FlowTest)
 
-	var outputPod v1.Pod
-	if err := r.Get(ctx, client.ObjectKey{Name: "logging-plumber-log-aggregator", Namespace: flowTest.ObjectMeta.Namespace}, &outputPod); err != nil {
+	// the key has to exist before the aggregator starts, it's read once on startup
+	if _, err := r.ingestionKey(ctx); err != nil {
+		return err
+	}
+	if _, err := r.aggregatorCertificates(ctx); err != nil {
+		return err
+	}
+
+	aggregatorArgs := []string{
+		"-addr", ":8080",
+		"-ingestion-key-file", "/etc/log-aggregator/ingestion/" + ingestionKeyField,
+		"-tls-addr", ":8443",
+		"-tls-cert-file", "/etc/log-aggregator/tls/" + v1.TLSCertKey,
+		"-tls-key-file", "/etc/log-aggregator/tls/" + v1.TLSPrivateKeyKey,
+	}
+	if r.AggregatorCallbackURL != "" {
+		aggregatorArgs = append(aggregatorArgs, "-notify-url", r.AggregatorCallbackURL)
+	}
+
+	labels := GetLabels("logging-plumber-log-aggregator", nil,
+		map[string]string{"loggingpipelineplumber.isala.me/component": "log-aggregator"})
+
+	// the records survive a restart of the aggregator on the data volume, a PVC keeps them when the pod moves
+	dataVolume := v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}
+	if r.AggregatorStorage.Size != "" {
+		if err := r.provisionAggregatorVolume(ctx, labels); err != nil {
+			return err
+		}
+		dataVolume = v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "logging-plumber-log-aggregator"},
+		}
+	}
+	aggregatorArgs = append(aggregatorArgs, "-data-dir", "/var/lib/log-aggregator")
+
+	var outputDeployment appsv1.Deployment
+	if err := r.Get(ctx, client.ObjectKey{Name: "logging-plumber-log-aggregator", Namespace: r.AggregatorNamespace}, &outputDeployment); err != nil {
 		if apierrors.IsNotFound(err) {
-			outputPod := v1.Pod{
+			replicas := int32(1)
+			// the volume is mounted by a single pod at a time, the bbolt file is locked by a single process
+			fsGroup := int64(65532)
+			outputDeployment := appsv1.Deployment{
 				TypeMeta: metav1.TypeMeta{
-					APIVersion: "V1",
-					Kind:       "Pod",
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
 				},
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "logging-plumber-log-aggregator",
 					Namespace: r.AggregatorNamespace,
-					Labels: GetLabels("logging-plumber-log-aggregator", nil,
-						map[string]string{"loggingpipelineplumber.isala.me/component": "log-aggregator"}),
+					Labels:    labels,
 				},
-				Spec: v1.PodSpec{
-					Containers: []v1.Container{{
-						Name:            "log-output",
-						Image:           fmt.Sprintf("%s:%s", r.LogOutputImage.Repository, r.LogOutputImage.Tag),
-						ImagePullPolicy: v1.PullPolicy(r.LogOutputImage.PullPolicy),
-						Ports: []v1.ContainerPort{{
-							Name:          "http",
-							ContainerPort: 80,
-							Protocol:      "TCP",
-						}},
-					}},
+				Spec: appsv1.DeploymentSpec{
+					Replicas: &replicas,
+					Selector: &metav1.LabelSelector{MatchLabels: labels},
+					Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+					Template: v1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec: v1.PodSpec{
+							SecurityContext: &v1.PodSecurityContext{FSGroup: &fsGroup},
+							Containers: []v1.Container{{
+								Name:            "log-aggregator",
+								Image:           fmt.Sprintf("%s:%s", r.AggregatorImage.Repository, r.AggregatorImage.Tag),
+								ImagePullPolicy: v1.PullPolicy(r.AggregatorImage.PullPolicy),
+								Command:         []string{"log-aggregator"},
+								Args:            aggregatorArgs,
+								Ports: []v1.ContainerPort{{
+									Name:          "http",
+									ContainerPort: 8080,
+									Protocol:      "TCP",
+								}, {
+									Name:          "https",
+									ContainerPort: 8443,
+									Protocol:      "TCP",
+								}},
+								ReadinessProbe: &v1.Probe{
+									Handler: v1.Handler{HTTPGet: &v1.HTTPGetAction{Path: "/healthz", Port: intstr.FromString("http")}},
+								},
+								LivenessProbe: &v1.Probe{
+									Handler: v1.Handler{HTTPGet: &v1.HTTPGetAction{Path: "/healthz", Port: intstr.FromString("http")}},
+								},
+								VolumeMounts: []v1.VolumeMount{{
+									Name:      "ingestion-key",
+									MountPath: "/etc/log-aggregator/ingestion",
+									ReadOnly:  true,
+								}, {
+									Name:      "tls",
+									MountPath: "/etc/log-aggregator/tls",
+									ReadOnly:  true,
+								}, {
+									Name:      "data",
+									MountPath: "/var/lib/log-aggregator",
+								}},
+							}},
+							Volumes: []v1.Volume{{
+								Name: "ingestion-key",
+								VolumeSource: v1.VolumeSource{
+									Secret: &v1.SecretVolumeSource{SecretName: ingestionKeySecret},
+								},
+							}, {
+								// rotated certificates show up in the mounted files, the aggregator reloads them
+								Name: "tls",
+								VolumeSource: v1.VolumeSource{
+									Secret: &v1.SecretVolumeSource{SecretName: aggregatorTLSSecret},
+								},
+							}, {
+								Name:         "data",
+								VolumeSource: dataVolume,
+							}},
+						},
+					},
 				},
 			}
-			if err := r.Create(ctx, &outputPod); err != nil {
+			if err := r.Create(ctx, &outputDeployment); err != nil {
 				if apierrors.IsAlreadyExists(err) {
-					logger.V(1).Info("found a already deployed log output pod")
+					logger.V(1).Info("found a already deployed log output deployment")
 				} else {
-					logger.Error(err, "failed to create the output pod pod")
+					logger.Error(err, "failed to create the output deployment")
 					return err
 				}
 			}
-			logger.V(1).Info("deployed log output pod", "pod-uuid", outputPod.UID)
+			logger.V(1).Info("deployed log output deployment", "deployment-uuid", outputDeployment.UID)
 
 			outputPodSVC := v1.Service{
 				TypeMeta: metav1.TypeMeta{
@@ -353,8 +599,13 @@ func (r *FlowTestReconciler) provisionOutputResource(ctx context.Context) error
 						Protocol:   "TCP",
 						Port:       80,
 						TargetPort: intstr.IntOrString{Type: intstr.String, StrVal: "http"},
+					}, {
+						Name:       "https",
+						Protocol:   "TCP",
+						Port:       443,
+						TargetPort: intstr.IntOrString{Type: intstr.String, StrVal: "https"},
 					}},
-					Selector: outputPod.Labels,
+					Selector: labels,
 				},
 			}
 
@@ -368,10 +619,89 @@ func (r *FlowTestReconciler) provisionOutputResource(ctx context.Context) error
 			}
 
 			logger.V(1).Info("deployed output pod service", "service-uuid", outputPodSVC.UID)
+
+			// fluentd of the Logging under test runs in its control namespace, make sure a default deny
+			// policy in the aggregator namespace doesn't keep it from delivering the sliced logs
+			httpPort := intstr.FromString("http")
+			httpsPort := intstr.FromString("https")
+			outputPodPolicy := networkingv1.NetworkPolicy{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "networking.k8s.io/v1",
+					Kind:       "NetworkPolicy",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "logging-plumber-log-aggregator",
+					Namespace: r.AggregatorNamespace,
+					Labels: GetLabels("logging-plumber-log-aggregator", nil,
+						map[string]string{"loggingpipelineplumber.isala.me/component": "log-aggregator"}),
+				},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: labels},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{{Port: &httpPort}, {Port: &httpsPort}},
+					}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				},
+			}
+
+			if err := r.Create(ctx, &outputPodPolicy); err != nil {
+				if apierrors.IsAlreadyExists(err) {
+					logger.V(1).Info("found a already deployed log output network policy")
+				} else {
+					logger.Error(err, "failed to create the output pod network policy")
+					return err
+				}
+			}
+
+			logger.V(1).Info("deployed output pod network policy", "network-policy-uuid", outputPodPolicy.UID)
 		}
 	} else {
-		logger.V(1).Info("found a already deployed log output pod", "pod-uuid", outputPod.UID)
+		logger.V(1).Info("found a already deployed log output deployment", "deployment-uuid", outputDeployment.UID)
 	}
 
 	return nil
 }
+
+// provisionAggregatorVolume creates the claim the log aggregator keeps its records on, it outlives the aggregator
+// pod so a rescheduled aggregator still has what the slices shipped before
+func (r *FlowTestReconciler) provisionAggregatorVolume(ctx context.Context, labels map[string]string) error {
+	logger := log.FromContext(ctx)
+
+	size, err := resource.ParseQuantity(r.AggregatorStorage.Size)
+	if err != nil {
+		logger.Error(err, "invalid log aggregator storage size", "size", r.AggregatorStorage.Size)
+		return err
+	}
+
+	claim := v1.PersistentVolumeClaim{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "V1",
+			Kind:       "PersistentVolumeClaim",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "logging-plumber-log-aggregator",
+			Namespace: r.AggregatorNamespace,
+			Labels:    labels,
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: size},
+			},
+		},
+	}
+	if r.AggregatorStorage.StorageClassName != "" {
+		claim.Spec.StorageClassName = &r.AggregatorStorage.StorageClassName
+	}
+
+	if err := r.Create(ctx, &claim); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			logger.V(1).Info("found a already provisioned log output volume")
+			return nil
+		}
+		logger.Error(err, "failed to create the output volume claim")
+		return err
+	}
+	logger.V(1).Info("provisioned log output volume", "pvc-uuid", claim.UID)
+	return nil
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// primaryReference is the reference-flow label value of the slices of spec.referenceFlow or the inline flow
+	primaryReference = "primary"
+	// candidateReference is the reference-flow label value of the slices of the inline flow in comparison mode
+	candidateReference = "candidate"
+)
+
+// referenceTarget is a flow under test along with where its results go in the status
+type referenceTarget struct {
+	loggingpipelineplumberv1beta1.ReferenceObject
+	// key tells the slices of different reference flows apart, it's primaryReference, candidateReference
+	// or the index in spec.referenceFlows
+	key     string
+	results *loggingpipelineplumberv1beta1.FlowResults
+	// inline specs are sliced in place of fetching the reference from the cluster
+	inlineFlow        *flowv1beta1.FlowSpec
+	inlineClusterFlow *flowv1beta1.ClusterFlowSpec
+}
+
+// referenceTargets lists every flow the flowtest has to slice, results of spec.referenceFlows entries
+// are kept in status.referenceFlows in the same order
+func referenceTargets(flowTest *loggingpipelineplumberv1beta1.FlowTest) []referenceTarget {
+	var targets []referenceTarget
+
+	inline := inlineTarget(flowTest)
+	switch {
+	case flowTest.Spec.ReferenceFlow != nil:
+		targets = append(targets, referenceTarget{
+			ReferenceObject: *flowTest.Spec.ReferenceFlow,
+			key:             primaryReference,
+			results:         &flowTest.Status.FlowResults,
+		})
+		// the live reference is the baseline the inline flow gets compared against
+		if flowTest.Spec.Comparison != nil && inline != nil {
+			if flowTest.Status.Comparison == nil {
+				flowTest.Status.Comparison = &loggingpipelineplumberv1beta1.ComparisonStatus{}
+			}
+			inline.key = candidateReference
+			inline.results = &flowTest.Status.Comparison.Candidate
+			targets = append(targets, *inline)
+		}
+	case inline != nil:
+		inline.key = primaryReference
+		inline.results = &flowTest.Status.FlowResults
+		targets = append(targets, *inline)
+	}
+
+	if len(flowTest.Status.ReferenceFlows) != len(flowTest.Spec.ReferenceFlows) {
+		flowTest.Status.ReferenceFlows = make([]loggingpipelineplumberv1beta1.ReferenceFlowStatus, len(flowTest.Spec.ReferenceFlows))
+	}
+	for i, reference := range flowTest.Spec.ReferenceFlows {
+		flowTest.Status.ReferenceFlows[i].ReferenceObject = reference
+		targets = append(targets, referenceTarget{
+			ReferenceObject: reference,
+			key:             fmt.Sprintf("%d", i),
+			results:         &flowTest.Status.ReferenceFlows[i].FlowResults,
+		})
+	}
+
+	return targets
+}
+
+// inlineTarget returns the inline flow of the flowtest without a key or a place for results
+func inlineTarget(flowTest *loggingpipelineplumberv1beta1.FlowTest) *referenceTarget {
+	if flowTest.Spec.InlineFlow != nil {
+		return &referenceTarget{
+			ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{
+				Kind:      "Flow",
+				Name:      flowTest.ObjectMeta.Name,
+				Namespace: flowTest.Spec.ReferencePod.Namespace,
+			},
+			inlineFlow: flowTest.Spec.InlineFlow,
+		}
+	}
+	if flowTest.Spec.InlineClusterFlow != nil {
+		return &referenceTarget{
+			// namespace depends on the Logging, see referenceClusterFlow
+			ReferenceObject: loggingpipelineplumberv1beta1.ReferenceObject{
+				Kind: "ClusterFlow",
+				Name: flowTest.ObjectMeta.Name,
+			},
+			inlineClusterFlow: flowTest.Spec.InlineClusterFlow,
+		}
+	}
+	return nil
+}
+
+// sliceName names the slices of the primary reference the same way as before there were many references
+func (t referenceTarget) sliceName(flowTest loggingpipelineplumberv1beta1.FlowTest, testID int, suffix string) string {
+	if t.key == primaryReference {
+		return fmt.Sprintf("%s-%d-%s", flowTest.ObjectMeta.UID, testID, suffix)
+	}
+	return fmt.Sprintf("%s-%s-%d-%s", flowTest.ObjectMeta.UID, t.key, testID, suffix)
+}
+
+// validateReferences makes sure the flowtest has something to test and that an inline spec doesn't
+// have to compete with a live reference over the status
+func validateReferences(flowTest loggingpipelineplumberv1beta1.FlowTest) error {
+	inline := 0
+	if flowTest.Spec.InlineFlow != nil {
+		inline++
+	}
+	if flowTest.Spec.InlineClusterFlow != nil {
+		inline++
+	}
+	if inline > 1 {
+		return fmt.Errorf("inlineFlow and inlineClusterFlow can't be used together")
+	}
+	if flowTest.Spec.Comparison != nil {
+		if inline == 0 || flowTest.Spec.ReferenceFlow == nil {
+			return fmt.Errorf("comparison needs a referenceFlow as the baseline and an inline flow as the candidate")
+		}
+	} else if inline > 0 && flowTest.Spec.ReferenceFlow != nil {
+		return fmt.Errorf("referenceFlow can only be used together with an inline flow in comparison mode")
+	}
+	if inline == 0 && flowTest.Spec.ReferenceFlow == nil && len(flowTest.Spec.ReferenceFlows) == 0 {
+		return fmt.Errorf("flowtest has neither a referenceFlow, an inline flow nor referenceFlows")
+	}
+	return nil
+}
+
+func (r *FlowTestReconciler) referenceFlow(ctx context.Context, target referenceTarget) (flowv1beta1.Flow, error) {
+	if target.inlineFlow != nil {
+		return flowv1beta1.Flow{
+			ObjectMeta: metav1.ObjectMeta{Name: target.Name, Namespace: target.Namespace},
+			Spec:       *target.inlineFlow.DeepCopy(),
+		}, nil
+	}
+
+	var referenceFlow flowv1beta1.Flow
+	err := r.Get(ctx, types.NamespacedName{
+		Namespace: target.Namespace,
+		Name:      target.Name,
+	}, &referenceFlow)
+	return referenceFlow, err
+}
+
+func (r *FlowTestReconciler) referenceClusterFlow(ctx context.Context, target referenceTarget) (flowv1beta1.ClusterFlow, error) {
+	if target.inlineClusterFlow != nil {
+		// ClusterFlows are only picked up from the control namespace of their Logging
+		logging, err := r.loggingByRef(ctx, target.inlineClusterFlow.LoggingRef)
+		if err != nil {
+			return flowv1beta1.ClusterFlow{}, err
+		}
+		return flowv1beta1.ClusterFlow{
+			ObjectMeta: metav1.ObjectMeta{Name: target.Name, Namespace: logging.Spec.ControlNamespace},
+			Spec:       *target.inlineClusterFlow.DeepCopy(),
+		}, nil
+	}
+
+	var referenceFlow flowv1beta1.ClusterFlow
+	err := r.Get(ctx, types.NamespacedName{
+		Namespace: target.Namespace,
+		Name:      target.Name,
+	}, &referenceFlow)
+	return referenceFlow, err
+}
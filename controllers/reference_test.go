@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReferenceTargets(t *testing.T) {
+	reference := func(name string) *loggingpipelineplumberv1beta1.ReferenceObject {
+		return &loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Flow", Name: name, Namespace: "apps"}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		spec  loggingpipelineplumberv1beta1.FlowTestSpec
+		keys  []string
+		names []string
+	}{
+		{
+			name:  "reference flow",
+			spec:  loggingpipelineplumberv1beta1.FlowTestSpec{ReferenceFlow: reference("flow")},
+			keys:  []string{primaryReference},
+			names: []string{"flow"},
+		},
+		{
+			name:  "inline flow",
+			spec:  loggingpipelineplumberv1beta1.FlowTestSpec{InlineFlow: &flowv1beta1.FlowSpec{}},
+			keys:  []string{primaryReference},
+			names: []string{"test"},
+		},
+		{
+			name: "comparison",
+			spec: loggingpipelineplumberv1beta1.FlowTestSpec{
+				ReferenceFlow: reference("flow"),
+				InlineFlow:    &flowv1beta1.FlowSpec{},
+				Comparison:    &loggingpipelineplumberv1beta1.ComparisonSpec{},
+			},
+			keys:  []string{primaryReference, candidateReference},
+			names: []string{"flow", "test"},
+		},
+		{
+			name: "reference flows",
+			spec: loggingpipelineplumberv1beta1.FlowTestSpec{
+				ReferenceFlow:  reference("flow"),
+				ReferenceFlows: []loggingpipelineplumberv1beta1.ReferenceObject{*reference("audit"), *reference("metrics")},
+			},
+			keys:  []string{primaryReference, "0", "1"},
+			names: []string{"flow", "audit", "metrics"},
+		},
+		{
+			name:  "only reference flows",
+			spec:  loggingpipelineplumberv1beta1.FlowTestSpec{ReferenceFlows: []loggingpipelineplumberv1beta1.ReferenceObject{*reference("audit")}},
+			keys:  []string{"0"},
+			names: []string{"audit"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.spec.ReferencePod = loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Pod", Name: "app", Namespace: "apps"}
+			flowTest := &loggingpipelineplumberv1beta1.FlowTest{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "uid"}, Spec: tc.spec}
+
+			var keys, names []string
+			for _, target := range referenceTargets(flowTest) {
+				keys = append(keys, target.key)
+				names = append(names, target.Name)
+				if target.results == nil {
+					t.Errorf("expected a place for the results of %s", target.key)
+				}
+			}
+			if !reflect.DeepEqual(keys, tc.keys) || !reflect.DeepEqual(names, tc.names) {
+				t.Errorf("expected the targets %v named %v, got %v named %v", tc.keys, tc.names, keys, names)
+			}
+		})
+	}
+
+	t.Run("results go to the status", func(t *testing.T) {
+		flowTest := &loggingpipelineplumberv1beta1.FlowTest{Spec: loggingpipelineplumberv1beta1.FlowTestSpec{
+			ReferenceFlow:  reference("flow"),
+			InlineFlow:     &flowv1beta1.FlowSpec{},
+			Comparison:     &loggingpipelineplumberv1beta1.ComparisonSpec{},
+			ReferenceFlows: []loggingpipelineplumberv1beta1.ReferenceObject{*reference("audit")},
+		}}
+		targets := referenceTargets(flowTest)
+		if targets[0].results != &flowTest.Status.FlowResults {
+			t.Error("expected the primary results in status.flowResults")
+		}
+		if flowTest.Status.Comparison == nil || targets[1].results != &flowTest.Status.Comparison.Candidate {
+			t.Error("expected the candidate results in status.comparison.candidate")
+		}
+		if len(flowTest.Status.ReferenceFlows) != 1 || targets[2].results != &flowTest.Status.ReferenceFlows[0].FlowResults ||
+			flowTest.Status.ReferenceFlows[0].ReferenceObject != *reference("audit") {
+			t.Errorf("expected the results of spec.referenceFlows in status.referenceFlows, got %+v", flowTest.Status.ReferenceFlows)
+		}
+	})
+}
+
+func TestSliceName(t *testing.T) {
+	flowTest := loggingpipelineplumberv1beta1.FlowTest{ObjectMeta: metav1.ObjectMeta{UID: "uid"}}
+	for _, tc := range []struct {
+		key  string
+		want string
+	}{
+		// the slices of the primary reference keep their names from before there were many references
+		{key: primaryReference, want: "uid-2-match"},
+		{key: candidateReference, want: "uid-candidate-2-match"},
+		{key: "0", want: "uid-0-2-match"},
+	} {
+		if got := (referenceTarget{key: tc.key}).sliceName(flowTest, 2, "match"); got != tc.want {
+			t.Errorf("expected %s for %s, got %s", tc.want, tc.key, got)
+		}
+	}
+}
+
+func TestValidateReferences(t *testing.T) {
+	reference := &loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Flow", Name: "flow", Namespace: "apps"}
+
+	for _, tc := range []struct {
+		name string
+		spec loggingpipelineplumberv1beta1.FlowTestSpec
+		err  string
+	}{
+		{name: "reference flow", spec: loggingpipelineplumberv1beta1.FlowTestSpec{ReferenceFlow: reference}},
+		{name: "inline flow", spec: loggingpipelineplumberv1beta1.FlowTestSpec{InlineFlow: &flowv1beta1.FlowSpec{}}},
+		{name: "reference flows", spec: loggingpipelineplumberv1beta1.FlowTestSpec{ReferenceFlows: []loggingpipelineplumberv1beta1.ReferenceObject{*reference}}},
+		{
+			name: "comparison",
+			spec: loggingpipelineplumberv1beta1.FlowTestSpec{ReferenceFlow: reference, InlineFlow: &flowv1beta1.FlowSpec{}, Comparison: &loggingpipelineplumberv1beta1.ComparisonSpec{}},
+		},
+		{name: "nothing to test", err: "flowtest has neither a referenceFlow, an inline flow nor referenceFlows"},
+		{
+			name: "both inline flows",
+			spec: loggingpipelineplumberv1beta1.FlowTestSpec{InlineFlow: &flowv1beta1.FlowSpec{}, InlineClusterFlow: &flowv1beta1.ClusterFlowSpec{}},
+			err:  "inlineFlow and inlineClusterFlow can't be used together",
+		},
+		{
+			name: "inline flow next to a reference flow",
+			spec: loggingpipelineplumberv1beta1.FlowTestSpec{ReferenceFlow: reference, InlineFlow: &flowv1beta1.FlowSpec{}},
+			err:  "referenceFlow can only be used together with an inline flow in comparison mode",
+		},
+		{
+			name: "comparison without a candidate",
+			spec: loggingpipelineplumberv1beta1.FlowTestSpec{ReferenceFlow: reference, Comparison: &loggingpipelineplumberv1beta1.ComparisonSpec{}},
+			err:  "comparison needs a referenceFlow as the baseline and an inline flow as the candidate",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateReferences(loggingpipelineplumberv1beta1.FlowTest{Spec: tc.spec})
+			if tc.err == "" && err != nil {
+				t.Errorf("expected the references to be valid, got %v", err)
+			}
+			if tc.err != "" && (err == nil || err.Error() != tc.err) {
+				t.Errorf("expected the error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestInlineTarget(t *testing.T) {
+	kubeClient := fakeclient.NewClientBuilder().
+		WithScheme(testScheme(t)).
+		WithObjects(&flowv1beta1.Logging{
+			ObjectMeta: metav1.ObjectMeta{Name: "logging"},
+			Spec:       flowv1beta1.LoggingSpec{LoggingRef: "infra", ControlNamespace: "logging"},
+		}).
+		Build()
+	r := &FlowTestReconciler{Client: kubeClient}
+
+	flowTest := &loggingpipelineplumberv1beta1.FlowTest{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec: loggingpipelineplumberv1beta1.FlowTestSpec{
+			ReferencePod:      loggingpipelineplumberv1beta1.ReferenceObject{Kind: "Pod", Name: "app", Namespace: "apps"},
+			InlineClusterFlow: &flowv1beta1.ClusterFlowSpec{LoggingRef: "infra"},
+		},
+	}
+	target := inlineTarget(flowTest)
+	if target == nil || target.Kind != "ClusterFlow" || target.Name != "test" || target.Namespace != "" {
+		t.Fatalf("expected an inline ClusterFlow without a namespace, got %+v", target)
+	}
+
+	// ClusterFlows are only picked up from the control namespace of their Logging
+	clusterFlow, err := r.referenceClusterFlow(context.Background(), *target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clusterFlow.ObjectMeta.Namespace != "logging" || clusterFlow.Spec.LoggingRef != "infra" {
+		t.Errorf("expected the inline ClusterFlow in the control namespace logging, got %+v", clusterFlow.ObjectMeta)
+	}
+
+	flowTest.Spec.InlineClusterFlow = nil
+	flowTest.Spec.InlineFlow = &flowv1beta1.FlowSpec{}
+	if target := inlineTarget(flowTest); target == nil || target.Kind != "Flow" || target.Namespace != "apps" {
+		t.Errorf("expected an inline Flow in the namespace of the reference pod, got %+v", target)
+	}
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// applyPodTemplates merges the given partial PodTemplateSpecs over the simulation pod in order,
+// the name and the namespace of the pod can't be overridden
+func applyPodTemplates(pod *v1.Pod, templates ...[]byte) error {
+	name, namespace := pod.ObjectMeta.Name, pod.ObjectMeta.Namespace
+
+	for _, template := range templates {
+		if len(template) == 0 {
+			continue
+		}
+
+		patch, err := podTemplatePatch(template, pod.Spec.Containers)
+		if err != nil {
+			return err
+		}
+
+		original, err := json.Marshal(pod)
+		if err != nil {
+			return err
+		}
+
+		merged, err := strategicpatch.StrategicMergePatch(original, patch, v1.Pod{})
+		if err != nil {
+			return fmt.Errorf("failed to merge pod template: %w", err)
+		}
+
+		var mergedPod v1.Pod
+		if err := json.Unmarshal(merged, &mergedPod); err != nil {
+			return err
+		}
+		*pod = mergedPod
+	}
+
+	pod.ObjectMeta.Name, pod.ObjectMeta.Namespace = name, namespace
+	return nil
+}
+
+// scheduleSimulationPod applies the pod templates and then pins the simulation pod to the node, if there is one.
+// Pinning goes last since a template with a node affinity replaces the required node selector terms.
+func scheduleSimulationPod(pod *v1.Pod, nodeName string, templates ...[]byte) error {
+	if err := applyPodTemplates(pod, templates...); err != nil {
+		return err
+	}
+	if nodeName != "" {
+		pod.Spec.Affinity = pinToNode(pod.Spec.Affinity, nodeName)
+	}
+	return nil
+}
+
+// podTemplatePatch turns a partial PodTemplateSpec into a strategic merge patch for the simulation pod,
+// containers are merged by name so the ones without a name get copied for every simulator container
+// and the named ones have to be one of them
+func podTemplatePatch(template []byte, containers []v1.Container) ([]byte, error) {
+	var patch map[string]interface{}
+	if err := json.Unmarshal(template, &patch); err != nil {
+		return nil, fmt.Errorf("pod template is not a valid object: %w", err)
+	}
+
+	spec, ok := patch["spec"].(map[string]interface{})
+	if !ok {
+		return json.Marshal(patch)
+	}
+
+	templateContainers, ok := spec["containers"].([]interface{})
+	if !ok {
+		return json.Marshal(patch)
+	}
+
+	var patchContainers []interface{}
+	for _, templateContainer := range templateContainers {
+		container, ok := templateContainer.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("pod template has an invalid container")
+		}
+		if name, _ := container["name"].(string); name != "" {
+			// merging a container the pod doesn't have would add one without an image
+			known := false
+			for _, simulatorContainer := range containers {
+				known = known || simulatorContainer.Name == name
+			}
+			if !known {
+				names := make([]string, 0, len(containers))
+				for _, simulatorContainer := range containers {
+					names = append(names, simulatorContainer.Name)
+				}
+				return nil, fmt.Errorf("pod template container %s is not one of the simulator containers %s", name, strings.Join(names, ", "))
+			}
+			patchContainers = append(patchContainers, container)
+			continue
+		}
+		for _, simulatorContainer := range containers {
+			named := make(map[string]interface{}, len(container)+1)
+			for k, v := range container {
+				named[k] = v
+			}
+			named["name"] = simulatorContainer.Name
+			patchContainers = append(patchContainers, named)
+		}
+	}
+	spec["containers"] = patchContainers
+
+	return json.Marshal(patch)
+}
+
+// mirrorReferencePod copies the annotations and the scheduling constraints of the reference pod onto the simulation pod,
+// and returns the parts of the kubernetes metadata which still differ
+func mirrorReferencePod(simulationPod *v1.Pod, referencePod v1.Pod, annotationDenylist []string) []loggingpipelineplumberv1beta1.UnreproducedMetadata {
+	var unreproduced []loggingpipelineplumberv1beta1.UnreproducedMetadata
+
+	for key, value := range referencePod.ObjectMeta.Annotations {
+		if deniedAnnotation(key, annotationDenylist) {
+			unreproduced = append(unreproduced, loggingpipelineplumberv1beta1.UnreproducedMetadata{
+				Field:  fmt.Sprintf("kubernetes.annotations.%s", key),
+				Reason: "annotation is in the denylist of the manager",
+			})
+			continue
+		}
+		if simulationPod.ObjectMeta.Annotations == nil {
+			simulationPod.ObjectMeta.Annotations = make(map[string]string)
+		}
+		simulationPod.ObjectMeta.Annotations[key] = value
+	}
+
+	simulationPod.Spec.Tolerations = referencePod.Spec.Tolerations
+	simulationPod.Spec.Affinity = referencePod.Spec.Affinity.DeepCopy()
+	simulationPod.Spec.PriorityClassName = referencePod.Spec.PriorityClassName
+
+	unreproduced = append(unreproduced, loggingpipelineplumberv1beta1.UnreproducedMetadata{
+		Field:  "kubernetes.pod_name",
+		Reason: fmt.Sprintf("logs come from %s instead of %s", simulationPod.ObjectMeta.Name, referencePod.ObjectMeta.Name),
+	})
+
+	for _, container := range simulationPod.Spec.Containers {
+		found := false
+		for _, referenceContainer := range referencePod.Spec.Containers {
+			if referenceContainer.Name != container.Name {
+				continue
+			}
+			found = true
+			unreproduced = append(unreproduced, loggingpipelineplumberv1beta1.UnreproducedMetadata{
+				Field:  "kubernetes.container_image",
+				Reason: fmt.Sprintf("container %s runs %s instead of %s", container.Name, container.Image, referenceContainer.Image),
+			})
+		}
+		if !found {
+			unreproduced = append(unreproduced, loggingpipelineplumberv1beta1.UnreproducedMetadata{
+				Field:  "kubernetes.container_name",
+				Reason: fmt.Sprintf("reference pod doesn't have a container named %s", container.Name),
+			})
+		}
+	}
+
+	// annotations come out of a map
+	sort.SliceStable(unreproduced, func(i, j int) bool {
+		return unreproduced[i].Field < unreproduced[j].Field
+	})
+
+	return unreproduced
+}
+
+// deniedAnnotation checks the annotation against the denylist, entries ending with * match by prefix
+func deniedAnnotation(key string, denylist []string) bool {
+	for _, denied := range denylist {
+		if strings.HasSuffix(denied, "*") && strings.HasPrefix(key, strings.TrimSuffix(denied, "*")) {
+			return true
+		}
+		if key == denied {
+			return true
+		}
+	}
+	return false
+}
+
+// pinToNode adds the node name to every required node selector term, so the mirrored affinity still applies.
+// The required pod anti-affinity is dropped, the mirrored labels make the simulation pod repel itself from
+// the node of the reference pod otherwise.
+func pinToNode(affinity *v1.Affinity, nodeName string) *v1.Affinity {
+	// pin by node name the same way DaemonSets do, so hosts matches see the node they expect
+	requirement := v1.NodeSelectorRequirement{
+		Key:      "metadata.name",
+		Operator: v1.NodeSelectorOpIn,
+		Values:   []string{nodeName},
+	}
+
+	if affinity == nil {
+		affinity = &v1.Affinity{}
+	}
+	if affinity.PodAntiAffinity != nil {
+		affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = nil
+	}
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &v1.NodeAffinity{}
+	}
+
+	required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchFields: []v1.NodeSelectorRequirement{requirement}}},
+		}
+		return affinity
+	}
+
+	for i := range required.NodeSelectorTerms {
+		required.NodeSelectorTerms[i].MatchFields = append(required.NodeSelectorTerms[i].MatchFields, requirement)
+	}
+	return affinity
+}
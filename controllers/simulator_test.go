@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyPodTemplates(t *testing.T) {
+	newPod := func() *v1.Pod {
+		pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "pod-simulator"}, {Name: "web", Image: "pod-simulator"}}}}
+		pod.ObjectMeta.Name, pod.ObjectMeta.Namespace = "uid-simulation", "default"
+		return pod
+	}
+
+	pod := newPod()
+	template := `{"metadata":{"name":"other"},"spec":{"containers":[{"env":[{"name":"A","value":"1"}]},{"name":"web","args":["-x"]}]}}`
+	if err := applyPodTemplates(pod, []byte(template)); err != nil {
+		t.Fatal(err)
+	}
+	if pod.ObjectMeta.Name != "uid-simulation" {
+		t.Errorf("expected the name to be kept, got %s", pod.ObjectMeta.Name)
+	}
+	if len(pod.Spec.Containers) != 2 {
+		t.Fatalf("expected no container to be added, got %+v", pod.Spec.Containers)
+	}
+	for _, container := range pod.Spec.Containers {
+		if len(container.Env) != 1 || container.Image != "pod-simulator" {
+			t.Errorf("expected the unnamed template container to apply to %s, got %+v", container.Name, container)
+		}
+	}
+	if args := pod.Spec.Containers[1].Args; len(args) != 1 || args[0] != "-x" {
+		t.Errorf("expected the named template container to apply to web only, got %v", args)
+	}
+
+	err := applyPodTemplates(newPod(), []byte(`{"spec":{"containers":[{"name":"sidecar","args":["-x"]}]}}`))
+	if err == nil || !strings.Contains(err.Error(), "sidecar") {
+		t.Errorf("expected an error naming the unknown container, got %v", err)
+	}
+}
+
+func TestScheduleSimulationPod(t *testing.T) {
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "pod-simulator"}}}}
+	template := `{"spec":{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[` +
+		`{"matchExpressions":[{"key":"pool","operator":"In","values":["logging"]}]}]}}}}}`
+
+	if err := scheduleSimulationPod(pod, "node-1", []byte(template)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []v1.NodeSelectorTerm{{
+		MatchExpressions: []v1.NodeSelectorRequirement{{Key: "pool", Operator: v1.NodeSelectorOpIn, Values: []string{"logging"}}},
+		MatchFields:      []v1.NodeSelectorRequirement{{Key: "metadata.name", Operator: v1.NodeSelectorOpIn, Values: []string{"node-1"}}},
+	}}
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.NodeAffinity == nil || pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		t.Fatalf("expected a required node affinity, got %+v", pod.Spec.Affinity)
+	}
+	if got := pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the pin to survive the template affinity, got %+v", got)
+	}
+
+	unpinned := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "pod-simulator"}}}}
+	if err := scheduleSimulationPod(unpinned, ""); err != nil {
+		t.Fatal(err)
+	}
+	if unpinned.Spec.Affinity != nil {
+		t.Errorf("expected a pod without a node to be left alone, got %+v", unpinned.Spec.Affinity)
+	}
+}
+
+func TestPinToNode(t *testing.T) {
+	antiAffinity := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		TopologyKey:   "kubernetes.io/hostname",
+	}
+	referencePod := v1.Pod{Spec: v1.PodSpec{Affinity: &v1.Affinity{
+		PodAntiAffinity: &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution:  []v1.PodAffinityTerm{antiAffinity},
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{Weight: 1, PodAffinityTerm: antiAffinity}},
+		},
+	}}}
+	simulationPod := v1.Pod{}
+	mirrorReferencePod(&simulationPod, referencePod, nil)
+
+	affinity := pinToNode(simulationPod.Spec.Affinity, "node-1")
+
+	if len(affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution) != 0 {
+		t.Errorf("expected the required pod anti-affinity to be dropped, got %+v", affinity.PodAntiAffinity)
+	}
+	if len(affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution) != 1 {
+		t.Errorf("expected the preferred pod anti-affinity to be kept, got %+v", affinity.PodAntiAffinity)
+	}
+	if len(referencePod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution) != 1 {
+		t.Error("expected the affinity of the reference pod to be left alone")
+	}
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || !reflect.DeepEqual(terms[0].MatchFields[0].Values, []string{"node-1"}) {
+		t.Errorf("expected the pod to be pinned to node-1, got %+v", terms)
+	}
+}
@@ -2,20 +2,27 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
 	filters "github.com/banzaicloud/logging-operator/pkg/sdk/model/filter"
-	"github.com/banzaicloud/logging-operator/pkg/sdk/model/output"
+	"github.com/mrsupiri/logging-pipeline-plumber/pkg/aggregator"
 	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+const (
+	// statusSampleRecords is the number of records of every slice copied to the status
+	statusSampleRecords = 3
+	// statusSampleRecordSize is the size of the longest record copied to the status
+	statusSampleRecordSize = 2048
+)
+
 const (
 	EventReasonProvision string = "Provision"
 	EventReasonCleanup          = "Cleanup"
@@ -34,6 +41,7 @@ func (r *FlowTestReconciler) flowTemplates(flow flowv1beta1.Flow, flowTest loggi
 			Labels:    GetLabels(flow.ObjectMeta.Name, &flowTest),
 		},
 		Spec: flowv1beta1.FlowSpec{
+			LoggingRef:      flow.Spec.LoggingRef,
 			LocalOutputRefs: nil,
 			Match:           nil,
 			Filters: []flowv1beta1.Filter{{
@@ -60,15 +68,14 @@ func (r *FlowTestReconciler) flowTemplates(flow flowv1beta1.Flow, flowTest loggi
 			Labels:    GetLabels(flow.ObjectMeta.Name, &flowTest),
 		},
 		Spec: flowv1beta1.OutputSpec{
-			HTTPOutput: &output.HTTPOutputConfig{
-				Endpoint: fmt.Sprintf("http://logging-plumber-log-aggregator.%s.svc", r.AggregatorNamespace),
-				Buffer: &output.Buffer{
-					FlushMode:     "interval",
-					FlushInterval: "1s",
-				},
-			},
+			LoggingRef: flow.Spec.LoggingRef,
 		},
 	}
+	if flowTest.Spec.OutputProtocol == loggingpipelineplumberv1beta1.ForwardProtocol {
+		outTemplate.Spec.ForwardOutput = r.ingestionForwardOutput(flowTest)
+	} else {
+		outTemplate.Spec.HTTPOutput = r.ingestionOutput(flowTest)
+	}
 
 	return flowTemplate, outTemplate
 }
@@ -81,10 +88,11 @@ func (r *FlowTestReconciler) clusterFlowTemplates(flow flowv1beta1.ClusterFlow,
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      fmt.Sprintf("%s-test", flow.ObjectMeta.Name),
-			Namespace: flowTest.Spec.ReferenceFlow.Namespace,
+			Namespace: flow.ObjectMeta.Namespace,
 			Labels:    GetLabels(flow.ObjectMeta.Name, &flowTest),
 		},
 		Spec: flowv1beta1.ClusterFlowSpec{
+			LoggingRef:       flow.Spec.LoggingRef,
 			GlobalOutputRefs: nil,
 			Match:            nil,
 			Filters: []flowv1beta1.Filter{{
@@ -107,21 +115,20 @@ func (r *FlowTestReconciler) clusterFlowTemplates(flow flowv1beta1.ClusterFlow,
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      fmt.Sprintf("%s-test", flow.ObjectMeta.Name),
-			Namespace: flowTest.Spec.ReferenceFlow.Namespace,
+			Namespace: flow.ObjectMeta.Namespace,
 			Labels:    GetLabels(flow.ObjectMeta.Name, &flowTest),
 		},
 		Spec: flowv1beta1.ClusterOutputSpec{
 			OutputSpec: flowv1beta1.OutputSpec{
-				HTTPOutput: &output.HTTPOutputConfig{
-					Endpoint: fmt.Sprintf("http://logging-plumber-log-aggregator.%s.svc", r.AggregatorNamespace),
-					Buffer: &output.Buffer{
-						FlushMode:     "interval",
-						FlushInterval: "1s",
-					},
-				},
+				LoggingRef: flow.Spec.LoggingRef,
 			},
 		},
 	}
+	if flowTest.Spec.OutputProtocol == loggingpipelineplumberv1beta1.ForwardProtocol {
+		outTemplate.Spec.ForwardOutput = r.ingestionForwardOutput(flowTest)
+	} else {
+		outTemplate.Spec.HTTPOutput = r.ingestionOutput(flowTest)
+	}
 
 	return flowTemplate, outTemplate
 }
@@ -140,60 +147,55 @@ func (r *FlowTestReconciler) setErrorStatus(ctx context.Context, err error) erro
 	return nil
 }
 
-type Index struct {
-	Name     string    `json:"name"`
-	FirstLog time.Time `json:"first_log"`
-	LastLog  time.Time `json:"last_log"`
-	LogCount int       `json:"log_count"`
-}
-
 type Image struct {
 	Repository string
 	Tag        string
 	PullPolicy string
 }
 
-// https://stackoverflow.com/a/40326580
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
-	}
-	return fallback
+// AggregatorStorage is the volume the log aggregator keeps its records on, an emptyDir when Size is empty
+type AggregatorStorage struct {
+	Size             string
+	StorageClassName string
 }
 
-func (r *FlowTestReconciler) checkIndex(ctx context.Context, indexName string) (bool, error) {
+// sampleRecords fetches the first records of the index for the status, records are cut at
+// statusSampleRecordSize so a chatty slice can't blow up the size of the FlowTest
+func (r *FlowTestReconciler) sampleRecords(ctx context.Context, indexName string) ([]string, error) {
 	logger := log.FromContext(ctx)
 
-	client := &http.Client{}
-
-	// NOTE: When developing this requires port-forward because controller is running locally
-	req, err := http.NewRequest("GET", getEnv("LOG_OUTPUT_ENDPOINT", fmt.Sprintf("http://logging-plumber-log-aggregator.%s.svc/", r.AggregatorNamespace)), nil)
-	if err != nil {
-		logger.Error(err, "failed to create request for checking indexes")
-		return false, err
+	page, err := r.Aggregator.Records(ctx, indexName, aggregator.RecordQuery{Limit: statusSampleRecords})
+	if errors.Is(err, aggregator.ErrIndexNotFound) {
+		return nil, nil
 	}
-	req.Header.Add("Accept", "application/json")
-	resp, err := client.Do(req)
 	if err != nil {
-		logger.Error(err, "failed to fetch log indexes")
-		return false, err
-	}
-	var indexes []Index
-	if err := json.NewDecoder(resp.Body).Decode(&indexes); err != nil {
-		logger.Error(err, "failed to fetch log indexes")
-		return false, err
-	}
-	for _, index := range indexes {
-		if index.Name == indexName {
-			if index.LogCount > 0 {
-				return true, nil
-			} else {
-				return false, nil
-			}
+		logger.Error(err, "failed to fetch records")
+		return nil, err
+	}
+
+	var sample []string
+	for _, record := range page.Records {
+		if len(record) > statusSampleRecordSize {
+			sample = append(sample, fmt.Sprintf("%s... (truncated)", record[:statusSampleRecordSize]))
+			continue
 		}
+		sample = append(sample, string(record))
 	}
+	return sample, nil
+}
 
-	return false, nil
+// recordTruncation copies the counters of the records the log aggregator let go of into the slice statuses
+func recordTruncation(flowTest *loggingpipelineplumberv1beta1.FlowTest, indexes map[string]aggregator.Index) {
+	for i := range flowTest.Status.Slices {
+		slice := &flowTest.Status.Slices[i]
+		index, ok := indexes[slice.Name]
+		if !ok {
+			continue
+		}
+		slice.DroppedRecords = index.Dropped
+		slice.EvictedRecords = index.Evicted
+		slice.Truncated = index.Truncated()
+	}
 }
 
 func GetLabels(name string, flowTest *loggingpipelineplumberv1beta1.FlowTest, labelsMaps ...map[string]string) map[string]string {
@@ -215,16 +217,162 @@ func GetLabels(name string, flowTest *loggingpipelineplumberv1beta1.FlowTest, la
 	return labels
 }
 
-func allTestPassing(status loggingpipelineplumberv1beta1.FlowTestStatus) bool {
-	for _, status := range status.MatchStatus {
-		if !status {
+func allTestPassing(status loggingpipelineplumberv1beta1.FlowTestStatus, now time.Time) bool {
+	for _, referenceFlow := range status.ReferenceFlows {
+		if !flowPassing(referenceFlow.FlowResults) {
 			return false
 		}
 	}
+	return flowPassing(status.FlowResults) && comparisonPassing(status.Comparison, now)
+}
+
+func flowPassing(status loggingpipelineplumberv1beta1.FlowResults) bool {
+	if !matchesPassing(status) {
+		return false
+	}
 	for _, status := range status.FilterStatus {
 		if !status {
 			return false
 		}
 	}
+	for _, status := range status.IsolatedFilterStatus {
+		if !status {
+			return false
+		}
+	}
+	// logs of an excluded pod never make it through the full pipeline, so there it passes by staying empty
+	if status.PipelineStatus != nil && *status.PipelineStatus == matchesExclude(status) {
+		return false
+	}
 	return true
 }
+
+// matchesExclude tells whether an exclude decided the matches, the simulated pod is then left out of the flow
+func matchesExclude(status loggingpipelineplumberv1beta1.FlowResults) bool {
+	for _, result := range status.MatchResults {
+		if result.Outcome == loggingpipelineplumberv1beta1.Excluded {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPassing tells whether the matches of the flow decided what happens to the logs of the simulated pod.
+// Matches are evaluated first-match-wins, so the excludes and selects that didn't match before the deciding one
+// and every match after it behave as intended without ever receiving logs.
+func matchesPassing(status loggingpipelineplumberv1beta1.FlowResults) bool {
+	if len(status.MatchStatus) == 0 {
+		return true
+	}
+	if len(status.MatchResults) < len(status.MatchStatus) {
+		return false
+	}
+	testable := false
+	for _, result := range status.MatchResults {
+		switch result.Outcome {
+		case loggingpipelineplumberv1beta1.Selected, loggingpipelineplumberv1beta1.Excluded:
+			return true
+		case loggingpipelineplumberv1beta1.Untestable:
+		default:
+			testable = true
+		}
+	}
+	// none of the matches could be tested, there is nothing left to wait for
+	return !testable
+}
+
+func slicingModeEnabled(flowTest *loggingpipelineplumberv1beta1.FlowTest, mode loggingpipelineplumberv1beta1.SlicingMode) bool {
+	// keep the original behaviour for flowtests created before slicing modes existed
+	if len(flowTest.Spec.SlicingModes) == 0 {
+		return mode == loggingpipelineplumberv1beta1.Cumulative
+	}
+	for _, slicingMode := range flowTest.Spec.SlicingModes {
+		if slicingMode == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// matchProbe builds the matches of the slice testing the x-th match of a Flow.
+// A select is evaluated together with the excludes that come before it, while an exclude
+// is turned into a select with the same criteria to find out if it catches the simulated pod.
+func matchProbe(matches []flowv1beta1.Match, x int) []flowv1beta1.Match {
+	if matches[x].Select == nil && matches[x].Exclude != nil {
+		return []flowv1beta1.Match{{
+			Select: &flowv1beta1.Select{
+				Labels:         matches[x].Exclude.Labels,
+				Hosts:          matches[x].Exclude.Hosts,
+				ContainerNames: matches[x].Exclude.ContainerNames,
+			},
+		}}
+	}
+
+	var probe []flowv1beta1.Match
+	for _, match := range matches[:x] {
+		if match.Select == nil && match.Exclude != nil {
+			probe = append(probe, match)
+		}
+	}
+	return append(probe, matches[x])
+}
+
+// clusterMatchProbe is the ClusterFlow counterpart of matchProbe
+func clusterMatchProbe(matches []flowv1beta1.ClusterMatch, x int) []flowv1beta1.ClusterMatch {
+	if matches[x].ClusterSelect == nil && matches[x].ClusterExclude != nil {
+		return []flowv1beta1.ClusterMatch{{
+			ClusterSelect: &flowv1beta1.ClusterSelect{
+				Namespaces:     matches[x].ClusterExclude.Namespaces,
+				Labels:         matches[x].ClusterExclude.Labels,
+				Hosts:          matches[x].ClusterExclude.Hosts,
+				ContainerNames: matches[x].ClusterExclude.ContainerNames,
+			},
+		}}
+	}
+
+	var probe []flowv1beta1.ClusterMatch
+	for _, match := range matches[:x] {
+		if match.ClusterSelect == nil && match.ClusterExclude != nil {
+			probe = append(probe, match)
+		}
+	}
+	return append(probe, matches[x])
+}
+
+// setSliceStatus records the outcome of the slice with the given metadata, a passing slice stays passing
+// even after its flow gets deleted
+func setSliceStatus(status *loggingpipelineplumberv1beta1.FlowTestStatus, slice metav1.ObjectMeta, outcome loggingpipelineplumberv1beta1.SliceOutcome, message string, sample []string) {
+	testID, _ := strconv.Atoi(slice.Labels["loggingpipelineplumber.isala.me/test-id"])
+	sliceStatus := loggingpipelineplumberv1beta1.SliceStatus{
+		Name:    slice.Name,
+		Type:    slice.Labels["loggingpipelineplumber.isala.me/test-type"],
+		TestID:  testID,
+		Outcome: outcome,
+		Message: message,
+		Sample:  sample,
+	}
+	for i := range status.Slices {
+		if status.Slices[i].Name == slice.Name {
+			// the counters reported by the aggregator are kept
+			status.Slices[i].Type = sliceStatus.Type
+			status.Slices[i].TestID = sliceStatus.TestID
+			status.Slices[i].Outcome = sliceStatus.Outcome
+			status.Slices[i].Message = sliceStatus.Message
+			status.Slices[i].Sample = sliceStatus.Sample
+			return
+		}
+	}
+	status.Slices = append(status.Slices, sliceStatus)
+}
+
+// pendingSliceOutcome tells apart a slice that didn't receive logs yet from one that never will because
+// logging-operator rejected its configuration
+func pendingSliceOutcome(flowStatus flowv1beta1.FlowStatus, configCheckFailure string) (loggingpipelineplumberv1beta1.SliceOutcome, string) {
+	if len(flowStatus.Problems) > 0 {
+		return loggingpipelineplumberv1beta1.ConfigRejected, strings.Join(flowStatus.Problems, "; ")
+	}
+	if configCheckFailure != "" {
+		return loggingpipelineplumberv1beta1.ConfigRejected, configCheckFailure
+	}
+	return loggingpipelineplumberv1beta1.Pending, ""
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+)
+
+func TestFlowPassing(t *testing.T) {
+	truth, falsity := true, false
+	for _, tc := range []struct {
+		name        string
+		excludes    []bool
+		matchStatus []bool
+		untestable  map[int]string
+		filters     []bool
+		pipeline    *bool
+		want        bool
+	}{
+		{name: "no matches", want: true},
+		{name: "select catches the pod", excludes: []bool{false}, matchStatus: []bool{true}, want: true},
+		{name: "nothing arrived yet", excludes: []bool{false, false}, matchStatus: []bool{false, false}, want: false},
+		{name: "exclude then select", excludes: []bool{true, false}, matchStatus: []bool{false, true}, want: true},
+		{name: "select after the deciding select", excludes: []bool{false, false}, matchStatus: []bool{true, false}, want: true},
+		{name: "exclude catches the pod", excludes: []bool{true, false}, matchStatus: []bool{true, false}, pipeline: &falsity, want: true},
+		{name: "only untestable matches", excludes: []bool{false}, matchStatus: []bool{false}, untestable: map[int]string{0: "hosts"}, want: true},
+		{name: "untestable next to a pending select", excludes: []bool{false, false}, matchStatus: []bool{false, false}, untestable: map[int]string{0: "hosts"}, want: false},
+		{name: "untestable next to a passing select", excludes: []bool{false, false}, matchStatus: []bool{false, true}, untestable: map[int]string{0: "hosts"}, want: true},
+		{name: "failing filter", excludes: []bool{false}, matchStatus: []bool{true}, filters: []bool{true, false}, want: false},
+		{name: "excluded pod with logs through the pipeline", excludes: []bool{true, false}, matchStatus: []bool{true, false}, pipeline: &truth, want: false},
+		{name: "selected pod with an empty pipeline", excludes: []bool{false}, matchStatus: []bool{true}, pipeline: &falsity, want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status := loggingpipelineplumberv1beta1.FlowResults{
+				MatchStatus:    tc.matchStatus,
+				FilterStatus:   tc.filters,
+				PipelineStatus: tc.pipeline,
+			}
+			if status.PipelineStatus == nil {
+				status.PipelineStatus = &truth
+			}
+			status.MatchResults = matchResults(tc.excludes, tc.matchStatus, untestableMatchResults(len(tc.matchStatus), tc.untestable))
+			if got := flowPassing(status); got != tc.want {
+				t.Errorf("expected flowPassing to be %v with %v, got %v", tc.want, status.MatchResults, got)
+			}
+		})
+	}
+
+	t.Run("results not computed yet", func(t *testing.T) {
+		if flowPassing(loggingpipelineplumberv1beta1.FlowResults{MatchStatus: []bool{true}}) {
+			t.Error("expected a flow without match results to be pending")
+		}
+	})
+}
+
+func TestMatchProbe(t *testing.T) {
+	excludeA := flowv1beta1.Match{Exclude: &flowv1beta1.Exclude{Labels: map[string]string{"app": "a"}}}
+	selectB := flowv1beta1.Match{Select: &flowv1beta1.Select{Labels: map[string]string{"app": "b"}}}
+	excludeC := flowv1beta1.Match{Exclude: &flowv1beta1.Exclude{Labels: map[string]string{"app": "c"}, ContainerNames: []string{"web"}}}
+	selectD := flowv1beta1.Match{Select: &flowv1beta1.Select{Labels: map[string]string{"app": "d"}}}
+	matches := []flowv1beta1.Match{excludeA, selectB, excludeC, selectD}
+
+	for _, tc := range []struct {
+		name string
+		x    int
+		want []flowv1beta1.Match
+	}{
+		{name: "exclude is probed as a select", x: 0, want: []flowv1beta1.Match{{Select: &flowv1beta1.Select{Labels: map[string]string{"app": "a"}}}}},
+		{name: "select keeps the excludes before it", x: 1, want: []flowv1beta1.Match{excludeA, selectB}},
+		{name: "exclude keeps its container names", x: 2, want: []flowv1beta1.Match{{Select: &flowv1beta1.Select{Labels: map[string]string{"app": "c"}, ContainerNames: []string{"web"}}}}},
+		{name: "earlier selects are left out", x: 3, want: []flowv1beta1.Match{excludeA, excludeC, selectD}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := matchProbe(matches, tc.x); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestClusterMatchProbe(t *testing.T) {
+	excludeA := flowv1beta1.ClusterMatch{ClusterExclude: &flowv1beta1.ClusterExclude{Namespaces: []string{"a"}, Hosts: []string{"node-1"}}}
+	selectB := flowv1beta1.ClusterMatch{ClusterSelect: &flowv1beta1.ClusterSelect{Labels: map[string]string{"app": "b"}}}
+	selectC := flowv1beta1.ClusterMatch{ClusterSelect: &flowv1beta1.ClusterSelect{Namespaces: []string{"c"}}}
+	matches := []flowv1beta1.ClusterMatch{excludeA, selectB, selectC}
+
+	for _, tc := range []struct {
+		name string
+		x    int
+		want []flowv1beta1.ClusterMatch
+	}{
+		{name: "exclude is probed as a select", x: 0, want: []flowv1beta1.ClusterMatch{{ClusterSelect: &flowv1beta1.ClusterSelect{Namespaces: []string{"a"}, Hosts: []string{"node-1"}}}}},
+		{name: "select keeps the excludes before it", x: 1, want: []flowv1beta1.ClusterMatch{excludeA, selectB}},
+		{name: "earlier selects are left out", x: 2, want: []flowv1beta1.ClusterMatch{excludeA, selectC}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := clusterMatchProbe(matches, tc.x); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSlicingModeEnabled(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		modes      []loggingpipelineplumberv1beta1.SlicingMode
+		cumulative bool
+		isolated   bool
+	}{
+		{name: "created before slicing modes", cumulative: true},
+		{name: "cumulative only", modes: []loggingpipelineplumberv1beta1.SlicingMode{loggingpipelineplumberv1beta1.Cumulative}, cumulative: true},
+		{name: "isolated only", modes: []loggingpipelineplumberv1beta1.SlicingMode{loggingpipelineplumberv1beta1.Isolated}, isolated: true},
+		{
+			name:       "both",
+			modes:      []loggingpipelineplumberv1beta1.SlicingMode{loggingpipelineplumberv1beta1.Isolated, loggingpipelineplumberv1beta1.Cumulative},
+			cumulative: true,
+			isolated:   true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			flowTest := &loggingpipelineplumberv1beta1.FlowTest{Spec: loggingpipelineplumberv1beta1.FlowTestSpec{SlicingModes: tc.modes}}
+			if got := slicingModeEnabled(flowTest, loggingpipelineplumberv1beta1.Cumulative); got != tc.cumulative {
+				t.Errorf("expected cumulative slicing to be %v, got %v", tc.cumulative, got)
+			}
+			if got := slicingModeEnabled(flowTest, loggingpipelineplumberv1beta1.Isolated); got != tc.isolated {
+				t.Errorf("expected isolated slicing to be %v, got %v", tc.isolated, got)
+			}
+		})
+	}
+}
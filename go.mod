@@ -4,11 +4,14 @@ go 1.16
 
 require (
 	github.com/banzaicloud/logging-operator/pkg/sdk v0.7.3
+	github.com/banzaicloud/operator-tools v0.23.0
 	github.com/go-logr/logr v0.4.0
 	github.com/gorilla/mux v1.7.3
 	github.com/onsi/ginkgo v1.14.1
 	github.com/onsi/gomega v1.10.2
 	github.com/rs/cors v1.8.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	go.etcd.io/bbolt v1.3.5
 	k8s.io/api v0.20.7
 	k8s.io/apimachinery v0.20.7
 	k8s.io/client-go v0.20.7
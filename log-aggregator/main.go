@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/mrsupiri/logging-pipeline-plumber/pkg/aggregator"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func main() {
+	var addr string
+	var tlsAddr string
+	var forwardAddr string
+	var tlsCertFile string
+	var tlsKeyFile string
+	var notifyURL string
+	var ingestionKeyFile string
+	var dataDir string
+	var limits aggregator.Limits
+	flag.StringVar(&addr, "addr", ":8080", "The address the log aggregator binds to.")
+	flag.StringVar(&tlsAddr, "tls-addr", ":8443", "The address the log aggregator accepts logs over TLS on.")
+	flag.StringVar(&forwardAddr, "forward-addr", "", "The address the fluent forward receiver binds to, disabled when empty.")
+	flag.StringVar(&tlsCertFile, "tls-cert-file", "", "Serving certificate, logs are only accepted over TLS when set and the plaintext address only serves the query API.")
+	flag.StringVar(&tlsKeyFile, "tls-key-file", "", "Private key of the serving certificate.")
+	flag.StringVar(&notifyURL, "notify-url", "", "Callback URL of the manager notified when an index receives its first records.")
+	flag.StringVar(&ingestionKeyFile, "ingestion-key-file", "", "File holding the key the ingestion tokens of the flowtests are derived from, writes aren't authenticated when empty.")
+	flag.StringVar(&dataDir, "data-dir", "", "Directory the indexes are persisted to so they survive restarts, only kept in memory when empty.")
+	flag.IntVar(&limits.MaxRecordsPerIndex, "max-records-per-index", 1000, "Number of records kept for every index, the oldest ones are evicted first, 0 for no limit.")
+	flag.IntVar(&limits.MaxBytesPerIndex, "max-bytes-per-index", 8<<20, "Size in bytes of the records kept for every index, the oldest ones are evicted first, 0 for no limit.")
+	flag.IntVar(&limits.MaxRecords, "max-records", 100000, "Number of records kept over all the indexes, the oldest ones are evicted first, 0 for no limit.")
+	flag.IntVar(&limits.MaxBytes, "max-bytes", 256<<20, "Size in bytes of the records kept over all the indexes, the oldest ones are evicted first, 0 for no limit.")
+	flag.IntVar(&limits.MaxRecordSize, "max-record-size", 64<<10, "Size in bytes of the largest record that gets kept, larger ones are only counted as dropped.")
+	flag.DurationVar(&limits.Retention, "retention", 2*time.Hour, "How long records are kept after they were received, 0 to keep them until they are evicted.")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	logger := ctrl.Log.WithName("log-aggregator")
+
+	var ingestionKey []byte
+	if ingestionKeyFile != "" {
+		key, err := ioutil.ReadFile(ingestionKeyFile)
+		if err != nil {
+			logger.Error(err, "failed to read the ingestion key")
+			os.Exit(1)
+		}
+		ingestionKey = bytes.TrimSpace(key)
+	} else {
+		logger.Info("ingestion key is not set, writes from anywhere in the cluster are accepted")
+	}
+
+	store := aggregator.NewStore(limits)
+	if dataDir != "" {
+		var err error
+		if store, err = aggregator.OpenStore(filepath.Join(dataDir, "aggregator.db"), limits); err != nil {
+			logger.Error(err, "failed to open the store", "data-dir", dataDir)
+			os.Exit(1)
+		}
+		logger.Info("loaded the persisted indexes", "count", len(store.Indexes()))
+	}
+
+	if limits.Retention > 0 {
+		go func() {
+			for now := range time.Tick(time.Minute) {
+				if err := store.Expire(now); err != nil {
+					logger.Error(err, "failed to evict expired records")
+				}
+			}
+		}()
+	}
+
+	aggregatorServer := aggregator.NewServer(store, aggregator.NewNotifier(notifyURL, ingestionKey, logger), ingestionKey, logger)
+
+	servers := []*http.Server{{Addr: addr, Handler: aggregatorServer.Handler()}}
+	if tlsCertFile != "" {
+		reloader, err := aggregator.NewCertificateReloader(tlsCertFile, tlsKeyFile)
+		if err != nil {
+			logger.Error(err, "failed to load the serving certificate")
+			os.Exit(1)
+		}
+		// logs only arrive encrypted, the plaintext address stays for probes and the manager
+		servers[0].Handler = aggregatorServer.APIHandler()
+		servers = append(servers, &http.Server{
+			Addr:      tlsAddr,
+			Handler:   aggregatorServer.Handler(),
+			TLSConfig: &tls.Config{GetCertificate: reloader.GetCertificate, MinVersion: tls.VersionTLS12},
+		})
+	}
+
+	for _, server := range servers {
+		go func(server *http.Server) {
+			logger.Info("starting log aggregator", "addr", server.Addr, "tls", server.TLSConfig != nil)
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				logger.Error(err, "log aggregator crashed")
+				os.Exit(1)
+			}
+		}(server)
+	}
+
+	var forwardListener net.Listener
+	if forwardAddr != "" {
+		var err error
+		if forwardListener, err = net.Listen("tcp", forwardAddr); err != nil {
+			logger.Error(err, "failed to start the forward receiver")
+			os.Exit(1)
+		}
+		go func() {
+			logger.Info("starting forward receiver", "addr", forwardAddr)
+			if err := aggregatorServer.ServeForward(forwardListener); err != nil && !errors.Is(err, net.ErrClosed) {
+				logger.Error(err, "forward receiver crashed")
+				os.Exit(1)
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if forwardListener != nil {
+		_ = forwardListener.Close()
+	}
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Error(err, "failed to shutdown the log aggregator")
+		}
+	}
+	if err := store.Close(); err != nil {
+		logger.Error(err, "failed to close the store")
+	}
+}
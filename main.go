@@ -17,9 +17,14 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/mrsupiri/logging-pipeline-plumber/pkg/aggregator"
 	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
 	"github.com/mrsupiri/logging-pipeline-plumber/pkg/webserver"
 
@@ -29,8 +34,10 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -59,22 +66,42 @@ func main() {
 	var probeAddr string
 	var webAddr string
 	var podSimulatorImage controllers.Image
-	var logOutputImage controllers.Image
+	var aggregatorImage controllers.Image
+	var aggregatorStorage controllers.AggregatorStorage
 	var aggregatorNamespace string
+	var callbackAddr string
+	var callbackURL string
+	var aggregatorEndpoint string
+	var aggregatorTimeout time.Duration
+	var aggregatorRetries int
+	var simulatorPodTemplate string
+	var annotationDenylist string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&webAddr, "web-addr", ":9090", "The address the frontend API endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 
 	flag.StringVar(&aggregatorNamespace, "aggregator-namespace", "default", "AggregatorNamespace where the log aggregator was installed to.")
+	flag.StringVar(&aggregatorEndpoint, "aggregator-endpoint", "", "URL of the log aggregator API, defaults to its service in the aggregator namespace.")
+	flag.DurationVar(&aggregatorTimeout, "aggregator-timeout", 10*time.Second, "Timeout of a single request to the log aggregator.")
+	flag.IntVar(&aggregatorRetries, "aggregator-retries", 2, "Number of times a failed request to the log aggregator is retried.")
+	flag.StringVar(&callbackAddr, "aggregator-callback-addr", ":9091", "The address the log aggregator notifications endpoint binds to.")
+	flag.StringVar(&callbackURL, "aggregator-callback-url", "", "URL the log aggregator reaches the notifications endpoint on, polling only when empty.")
 
 	flag.StringVar(&podSimulatorImage.Repository, "pod-simulator-image-repository", "ghcr.io/mrsupiri/rancher-logging-pipeline-plumber/pod-simulator", "container image URI for pod simulator")
 	flag.StringVar(&podSimulatorImage.Tag, "pod-simulator-image-tag", "latest", "pod simulator container tag")
 	flag.StringVar(&podSimulatorImage.PullPolicy, "pod-simulator-image-pull-policy", "IfNotPresent", "pull policy pod simulator container")
 
-	flag.StringVar(&logOutputImage.Repository, "log-output-image-repository", "paynejacob/log-output", "container image URI for log-output")
-	flag.StringVar(&logOutputImage.Tag, "log-output-image-tag", "latest", "log-output container tag")
-	flag.StringVar(&logOutputImage.PullPolicy, "log-output-image-pull-policy", "IfNotPresent", "pull policy log-output container")
+	flag.StringVar(&simulatorPodTemplate, "simulator-pod-template", "", "partial PodTemplateSpec in JSON merged over every simulation pod")
+
+	flag.StringVar(&annotationDenylist, "simulator-annotation-denylist", "kubectl.kubernetes.io/last-applied-configuration,kubernetes.io/psp,cni.projectcalico.org/*,k8s.v1.cni.cncf.io/*",
+		"comma separated annotations of the reference pod not to copy to the simulation pod, entries ending with * match by prefix")
+
+	flag.StringVar(&aggregatorImage.Repository, "aggregator-image-repository", "ghcr.io/mrsupiri/rancher-logging-pipeline-plumber", "container image URI for log aggregator")
+	flag.StringVar(&aggregatorImage.Tag, "aggregator-image-tag", "latest", "log aggregator container tag")
+	flag.StringVar(&aggregatorImage.PullPolicy, "aggregator-image-pull-policy", "IfNotPresent", "pull policy log aggregator container")
+	flag.StringVar(&aggregatorStorage.Size, "aggregator-storage-size", "", "size of the volume claim the log aggregator keeps its records on, an emptyDir when empty")
+	flag.StringVar(&aggregatorStorage.StorageClassName, "aggregator-storage-class", "", "storage class of the log aggregator volume claim, the cluster default when empty")
 
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
@@ -100,13 +127,40 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.FlowTestReconciler{
+	if simulatorPodTemplate != "" && !json.Valid([]byte(simulatorPodTemplate)) {
+		setupLog.Error(fmt.Errorf("invalid JSON"), "unable to parse the simulator pod template")
+		os.Exit(1)
+	}
+
+	if aggregatorEndpoint == "" {
+		aggregatorEndpoint = fmt.Sprintf("http://logging-plumber-log-aggregator.%s.svc", aggregatorNamespace)
+	}
+
+	notifications := make(chan event.GenericEvent, 100)
+	if err := mgr.Add(&controllers.NotificationReceiver{
+		Addr:                callbackAddr,
 		AggregatorNamespace: aggregatorNamespace,
-		PodSimulatorImage:   podSimulatorImage,
-		LogOutputImage:      logOutputImage,
 		Client:              mgr.GetClient(),
-		Scheme:              mgr.GetScheme(),
-		Recorder:            mgr.GetEventRecorderFor("flowtest-controller"),
+		Events:              notifications,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up notification receiver")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.FlowTestReconciler{
+		AggregatorNamespace:   aggregatorNamespace,
+		PodSimulatorImage:     podSimulatorImage,
+		AggregatorImage:       aggregatorImage,
+		AggregatorStorage:     aggregatorStorage,
+		AggregatorCallbackURL: callbackURL,
+		Notifications:         notifications,
+		SimulatorPodTemplate:  []byte(simulatorPodTemplate),
+		AnnotationDenylist:    strings.Split(annotationDenylist, ","),
+		Client:                mgr.GetClient(),
+		KubeClient:            kubernetes.NewForConfigOrDie(mgr.GetConfig()),
+		Scheme:                mgr.GetScheme(),
+		Recorder:              mgr.GetEventRecorderFor("flowtest-controller"),
+		Aggregator:            aggregator.NewHTTPClient(aggregatorEndpoint, aggregatorTimeout, aggregatorRetries),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "FlowTest")
 		os.Exit(1)
@@ -114,7 +168,7 @@ func main() {
 	//+kubebuilder:scaffold:builder
 	setupLog.Info("starting web webserver", "addr", webAddr)
 	ctx := ctrl.SetupSignalHandler()
-	webServer := webserver.NewWebServer(webAddr)
+	webServer := webserver.NewWebServer(webAddr, mgr.GetClient())
 	go webServer.ListenAndServe(ctx.Done())
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -0,0 +1,34 @@
+package aggregator
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// IngestionToken is the password the slices of a flowtest ship their logs with, it's derived from the
+// ingestion key shared by the manager and the aggregator so the aggregator doesn't have to be told about every test
+func IngestionToken(key []byte, testUID string) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(testUID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authorize checks the basic auth credentials of a write against the index, the username is the UID of the
+// flowtest and only the indexes of that flowtest, which are prefixed with it, accept its token
+func authorize(key []byte, r *http.Request, index string) error {
+	testUID, token, ok := r.BasicAuth()
+	if !ok {
+		return fmt.Errorf("write without credentials")
+	}
+	if testUID == "" || !strings.HasPrefix(index, testUID+"-") {
+		return fmt.Errorf("write with the credentials of flowtest %s", testUID)
+	}
+	if !hmac.Equal([]byte(token), []byte(IngestionToken(key, testUID))) {
+		return fmt.Errorf("write with an invalid token")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package aggregator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestAuthorize(t *testing.T) {
+	key := []byte("ingestion-key")
+
+	for _, tc := range []struct {
+		name     string
+		index    string
+		username string
+		token    string
+		noAuth   bool
+		wantErr  bool
+	}{
+		{name: "own token", index: "uid-a-0-match", username: "uid-a", token: IngestionToken(key, "uid-a")},
+		{name: "token of another flowtest", index: "uid-a-0-match", username: "uid-b", token: IngestionToken(key, "uid-b"), wantErr: true},
+		{name: "own username with the token of another flowtest", index: "uid-a-0-match", username: "uid-a", token: IngestionToken(key, "uid-b"), wantErr: true},
+		{name: "username that only prefixes the uid", index: "uid-ab-0-match", username: "uid-a", token: IngestionToken(key, "uid-a"), wantErr: true},
+		{name: "token from another key", index: "uid-a-0-match", username: "uid-a", token: IngestionToken([]byte("other"), "uid-a"), wantErr: true},
+		{name: "control token", index: "uid-a-0-match", username: "uid-a", token: ControlToken(key, "uid-a"), wantErr: true},
+		{name: "empty username", index: "-0-match", username: "", token: IngestionToken(key, ""), wantErr: true},
+		{name: "missing token", index: "uid-a-0-match", noAuth: true, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/"+tc.index, nil)
+			if !tc.noAuth {
+				r.SetBasicAuth(tc.username, tc.token)
+			}
+			err := authorize(key, r, tc.index)
+			if tc.wantErr && err == nil {
+				t.Error("expected the write to be rejected")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("expected the write to be accepted, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIngestRejectsUnauthorizedWrites(t *testing.T) {
+	key := []byte("ingestion-key")
+	store := NewStore(Limits{})
+	handler := NewServer(store, nil, key, logr.Discard()).Handler()
+
+	write := func(index string, username string, token string) int {
+		r := httptest.NewRequest(http.MethodPost, "/"+index+"/", strings.NewReader(`{"log":"a"}`))
+		if username != "" {
+			r.SetBasicAuth(username, token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := write("uid-a-0-match", "uid-a", IngestionToken(key, "uid-a")); code != http.StatusOK {
+		t.Errorf("expected the own token to be accepted, got %d", code)
+	}
+	if code := write("uid-a-0-match", "uid-b", IngestionToken(key, "uid-b")); code != http.StatusUnauthorized {
+		t.Errorf("expected the token of another flowtest to be rejected, got %d", code)
+	}
+	if code := write("uid-a-0-match", "", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected a write without a token to be rejected, got %d", code)
+	}
+
+	index, _ := store.Index("uid-a-0-match")
+	if index.LogCount != 1 || index.Rejected != 2 {
+		t.Errorf("expected 1 record and 2 rejected writes, got %+v", index)
+	}
+}
@@ -0,0 +1,151 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrIndexNotFound is returned when nothing was received on the index yet
+var ErrIndexNotFound = errors.New("index not found")
+
+// HTTPClient talks to the versioned API of the log aggregator
+type HTTPClient struct {
+	endpoint string
+	client   *http.Client
+	retries  int
+	backoff  time.Duration
+}
+
+// NewHTTPClient creates a client for the aggregator at endpoint, every request gives up after timeout
+// and failed requests are retried the given number of times
+func NewHTTPClient(endpoint string, timeout time.Duration, retries int) *HTTPClient {
+	return &HTTPClient{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: timeout},
+		retries:  retries,
+		backoff:  500 * time.Millisecond,
+	}
+}
+
+// Indexes fetches every index in a single request, keyed by name
+func (c *HTTPClient) Indexes(ctx context.Context) (map[string]Index, error) {
+	var indexes []Index
+	if err := c.get(ctx, APIPrefix+"/indexes", &indexes); err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]Index, len(indexes))
+	for _, index := range indexes {
+		byName[index.Name] = index
+	}
+	return byName, nil
+}
+
+// Records fetches a page of the records of the index
+func (c *HTTPClient) Records(ctx context.Context, name string, query RecordQuery) (RecordPage, error) {
+	params := url.Values{}
+	params.Set("offset", strconv.Itoa(query.Offset))
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+	if len(query.Fields) > 0 {
+		params.Set("fields", strings.Join(query.Fields, ","))
+	}
+	if query.Search != "" {
+		params.Set("q", query.Search)
+	}
+
+	var page RecordPage
+	err := c.get(ctx, fmt.Sprintf("%s/indexes/%s/records?%s", APIPrefix, url.PathEscape(name), params.Encode()), &page)
+	return page, err
+}
+
+// SetFaults replaces the faults injected into the slices of the flowtest, token is its ControlToken
+func (c *HTTPClient) SetFaults(ctx context.Context, testUID string, token string, faults []Fault) error {
+	if faults == nil {
+		faults = []Fault{}
+	}
+	body, err := json.Marshal(faults)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("%s%s/faults/%s", c.endpoint, APIPrefix, url.PathEscape(testUID)), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth(testUID, token)
+		return req, nil
+	}, nil)
+}
+
+// get decodes the response of the path into out
+func (c *HTTPClient) get(ctx context.Context, path string, out interface{}) error {
+	return c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Accept", "application/json")
+		return req, nil
+	}, out)
+}
+
+// do sends the request and decodes the response into out unless it's nil, server errors and network errors are retried
+func (c *HTTPClient) do(ctx context.Context, newRequest func() (*http.Request, error), out interface{}) error {
+	var err error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * c.backoff):
+			}
+		}
+
+		var retry bool
+		if retry, err = c.doOnce(newRequest, out); !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *HTTPClient) doOnce(newRequest func() (*http.Request, error), out interface{}) (bool, error) {
+	req, err := newRequest()
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, ErrIndexNotFound
+	case resp.StatusCode >= 500:
+		return true, fmt.Errorf("log aggregator responded with %s", resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return false, fmt.Errorf("log aggregator responded with %s", resp.Status)
+	}
+
+	if out == nil {
+		return false, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("failed to decode the response of the log aggregator: %w", err)
+	}
+	return false, nil
+}
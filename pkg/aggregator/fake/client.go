@@ -0,0 +1,69 @@
+// Package fake provides an in-memory log aggregator client for tests
+package fake
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mrsupiri/logging-pipeline-plumber/pkg/aggregator"
+)
+
+// Client serves indexes and records from an in-memory store instead of a running aggregator
+type Client struct {
+	Store *aggregator.Store
+	// Err is returned by every call when set
+	Err error
+	// Faults holds the faults set for every flowtest
+	Faults map[string][]aggregator.Fault
+}
+
+func NewClient() *Client {
+	return &Client{
+		Store:  aggregator.NewStore(aggregator.Limits{MaxRecordsPerIndex: 1000, MaxRecordSize: 64 << 10}),
+		Faults: map[string][]aggregator.Fault{},
+	}
+}
+
+// Receive adds records to the index the same way the aggregator does when fluentd ships them
+func (c *Client) Receive(index string, records ...string) {
+	raw := make([]json.RawMessage, 0, len(records))
+	for _, record := range records {
+		raw = append(raw, json.RawMessage(record))
+	}
+	_, _ = c.Store.Add(index, raw)
+}
+
+// Reject counts a write to the index that failed authentication
+func (c *Client) Reject(index string) {
+	_, _ = c.Store.Reject(index)
+}
+
+func (c *Client) Indexes(_ context.Context) (map[string]aggregator.Index, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	indexes := map[string]aggregator.Index{}
+	for _, index := range c.Store.Indexes() {
+		indexes[index.Name] = index
+	}
+	return indexes, nil
+}
+
+func (c *Client) Records(_ context.Context, name string, query aggregator.RecordQuery) (aggregator.RecordPage, error) {
+	if c.Err != nil {
+		return aggregator.RecordPage{}, c.Err
+	}
+	page, ok := c.Store.Records(name, query)
+	if !ok {
+		return page, aggregator.ErrIndexNotFound
+	}
+	return page, nil
+}
+
+func (c *Client) SetFaults(_ context.Context, testUID string, _ string, faults []aggregator.Fault) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	c.Faults[testUID] = faults
+	return nil
+}
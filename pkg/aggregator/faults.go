@@ -0,0 +1,191 @@
+package aggregator
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// EventTimeKey is the record key the slices under a fault stamp with the time of the event, so a record
+// fluentd sent again can be told apart from the same message logged again. It's removed before the record is kept.
+const EventTimeKey = "plumber_event_time"
+
+// FaultMode is the way the aggregator misbehaves towards the indexes of a fault
+type FaultMode string
+
+const (
+	// FaultServerError answers the writes with a 5xx, the forward receiver closes the connection without an ack
+	FaultServerError FaultMode = "ServerError"
+	// FaultLatency delays the writes before they are kept and acknowledged
+	FaultLatency FaultMode = "Latency"
+	// FaultDrop acknowledges the writes and throws the records away
+	FaultDrop FaultMode = "Drop"
+	// FaultUnavailable closes the connections without an answer, as if the aggregator was down
+	FaultUnavailable FaultMode = "Unavailable"
+)
+
+// Fault is injected into the writes to its indexes between Start and End, a zero End never ends
+type Fault struct {
+	Indexes    []string      `json:"indexes"`
+	Mode       FaultMode     `json:"mode"`
+	StatusCode int           `json:"statusCode,omitempty"`
+	Latency    time.Duration `json:"latency,omitempty"`
+	Start      time.Time     `json:"start"`
+	End        time.Time     `json:"end,omitempty"`
+}
+
+func (f Fault) activeAt(now time.Time) bool {
+	return !now.Before(f.Start) && (f.End.IsZero() || now.Before(f.End))
+}
+
+// ControlToken is what the manager configures the faults of a flowtest with, it's derived from the ingestion key
+// apart from the ingestion token so the slices can't change their own faults
+func ControlToken(key []byte, testUID string) string {
+	return IngestionToken(key, "control/"+testUID)
+}
+
+// faultRegistry holds the faults of every flowtest, they are only kept in memory and the manager sets them again
+// on every check
+type faultRegistry struct {
+	mu     sync.RWMutex
+	faults map[string][]Fault
+}
+
+// active returns the fault injected into a write to the index right now
+func (f *faultRegistry) active(index string, now time.Time) (Fault, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for testUID, faults := range f.faults {
+		if !strings.HasPrefix(index, testUID+"-") {
+			continue
+		}
+		for _, fault := range faults {
+			if !fault.activeAt(now) {
+				continue
+			}
+			for _, name := range fault.Indexes {
+				if name == index {
+					return fault, true
+				}
+			}
+		}
+	}
+	return Fault{}, false
+}
+
+// setFaults replaces the faults of a flowtest, an empty list removes them
+func (s *Server) setFaults(w http.ResponseWriter, r *http.Request) {
+	testUID := mux.Vars(r)["uid"]
+	if len(s.ingestionKey) > 0 {
+		username, token, ok := r.BasicAuth()
+		if !ok || username != testUID || !hmac.Equal([]byte(token), []byte(ControlToken(s.ingestionKey, testUID))) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+	}
+
+	var faults []Fault
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&faults); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid faults: %s", err)})
+		return
+	}
+	for _, fault := range faults {
+		for _, index := range fault.Indexes {
+			if !strings.HasPrefix(index, testUID+"-") {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("index %s doesn't belong to flowtest %s", index, testUID)})
+				return
+			}
+		}
+	}
+
+	s.faults.mu.Lock()
+	if len(faults) == 0 {
+		delete(s.faults.faults, testUID)
+	} else {
+		s.faults.faults[testUID] = faults
+	}
+	s.faults.mu.Unlock()
+
+	s.logger.V(1).Info("configured faults", "flowtest", testUID, "count", len(faults))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// injectHTTPFault misbehaves towards a write to the index if a fault is active, it reports whether the write was answered
+func (s *Server) injectHTTPFault(w http.ResponseWriter, r *http.Request, name string) bool {
+	fault, ok := s.faults.active(name, time.Now())
+	if !ok {
+		return false
+	}
+
+	switch fault.Mode {
+	case FaultLatency:
+		select {
+		case <-r.Context().Done():
+		case <-time.After(fault.Latency):
+		}
+		s.countFault(name, 0)
+		return false
+	case FaultDrop:
+		records, err := decodeRecords(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return true
+		}
+		s.countFault(name, len(records))
+		w.WriteHeader(http.StatusOK)
+	case FaultUnavailable:
+		s.countFault(name, 0)
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				_ = conn.Close()
+				return true
+			}
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	default:
+		s.countFault(name, 0)
+		statusCode := fault.StatusCode
+		if statusCode < 500 || statusCode > 599 {
+			statusCode = http.StatusServiceUnavailable
+		}
+		http.Error(w, "injected fault", statusCode)
+	}
+	return true
+}
+
+func (s *Server) countFault(name string, discarded int) {
+	if err := s.store.Fault(name, discarded); err != nil {
+		s.logger.Error(err, "failed to count the injected fault", "index", name)
+	}
+}
+
+// unstamp removes EventTimeKey from the record, the digest of the stamped record tells whether it arrived before
+func unstamp(record json.RawMessage) (json.RawMessage, [sha256.Size]byte, bool) {
+	if !bytes.Contains(record, []byte(EventTimeKey)) {
+		return record, [sha256.Size]byte{}, false
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(record, &object); err != nil {
+		return record, [sha256.Size]byte{}, false
+	}
+	if _, ok := object[EventTimeKey]; !ok {
+		return record, [sha256.Size]byte{}, false
+	}
+
+	digest := sha256.Sum256(record)
+	delete(object, EventTimeKey)
+	stripped, err := json.Marshal(object)
+	if err != nil {
+		return record, [sha256.Size]byte{}, false
+	}
+	return stripped, digest, true
+}
@@ -0,0 +1,125 @@
+package aggregator
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestSetFaults(t *testing.T) {
+	key := []byte("ingestion-key")
+	faults := `[{"indexes":["uid-0-match"],"mode":"Drop","start":"2021-01-01T00:00:00Z"}]`
+
+	for _, tc := range []struct {
+		name     string
+		username string
+		token    string
+		body     string
+		code     int
+	}{
+		{name: "control token", username: "uid", token: ControlToken(key, "uid"), body: faults, code: http.StatusNoContent},
+		{name: "ingestion token", username: "uid", token: IngestionToken(key, "uid"), body: faults, code: http.StatusUnauthorized},
+		{name: "control token of another flowtest", username: "other", token: ControlToken(key, "other"), body: faults, code: http.StatusUnauthorized},
+		{name: "missing token", body: faults, code: http.StatusUnauthorized},
+		{
+			name: "index of another flowtest", username: "uid", token: ControlToken(key, "uid"),
+			body: `[{"indexes":["other-0-match"],"mode":"Drop","start":"2021-01-01T00:00:00Z"}]`, code: http.StatusBadRequest,
+		},
+		{name: "invalid faults", username: "uid", token: ControlToken(key, "uid"), body: `{`, code: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(NewStore(Limits{}), nil, key, logr.Discard())
+			r := httptest.NewRequest(http.MethodPut, APIPrefix+"/faults/uid", strings.NewReader(tc.body))
+			if tc.username != "" {
+				r.SetBasicAuth(tc.username, tc.token)
+			}
+			w := httptest.NewRecorder()
+			server.APIHandler().ServeHTTP(w, r)
+
+			if w.Code != tc.code {
+				t.Errorf("expected %d, got %d: %s", tc.code, w.Code, w.Body)
+			}
+			_, active := server.faults.active("uid-0-match", time.Now())
+			if active != (tc.code == http.StatusNoContent) {
+				t.Errorf("expected the fault to be configured only when accepted, got %t", active)
+			}
+		})
+	}
+}
+
+func TestInjectHTTPFault(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		fault     Fault
+		code      int
+		logCount  int
+		discarded int
+		faulted   int
+	}{
+		{name: "drop", fault: Fault{Mode: FaultDrop}, code: http.StatusOK, discarded: 2, faulted: 1},
+		{name: "server error", fault: Fault{Mode: FaultServerError, StatusCode: http.StatusBadGateway}, code: http.StatusBadGateway, faulted: 1},
+		{name: "server error outside 5xx", fault: Fault{Mode: FaultServerError, StatusCode: http.StatusOK}, code: http.StatusServiceUnavailable, faulted: 1},
+		{name: "latency", fault: Fault{Mode: FaultLatency, Latency: time.Millisecond}, code: http.StatusOK, logCount: 2, faulted: 1},
+		{name: "ended", fault: Fault{Mode: FaultDrop, End: time.Now().Add(-time.Minute)}, code: http.StatusOK, logCount: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewStore(Limits{})
+			server := NewServer(store, nil, nil, logr.Discard())
+			tc.fault.Indexes = []string{"uid-0-match"}
+			tc.fault.Start = time.Now().Add(-time.Hour)
+			server.faults.faults["uid"] = []Fault{tc.fault}
+
+			r := httptest.NewRequest(http.MethodPost, "/uid-0-match/", strings.NewReader(`[{"log":"a"},{"log":"b"}]`))
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, r)
+
+			if w.Code != tc.code {
+				t.Errorf("expected %d, got %d", tc.code, w.Code)
+			}
+			index, _ := store.Index("uid-0-match")
+			if index.LogCount != tc.logCount || index.Discarded != tc.discarded || index.Faulted != tc.faulted {
+				t.Errorf("expected %d kept, %d discarded records and %d faulted writes, got %+v", tc.logCount, tc.discarded, tc.faulted, index)
+			}
+		})
+	}
+}
+
+func TestUnstamp(t *testing.T) {
+	stamped := fmt.Sprintf(`{"log":"a",%q:"1.0"}`, EventTimeKey)
+
+	for _, tc := range []struct {
+		name    string
+		record  string
+		want    string
+		stamped bool
+	}{
+		{name: "stamped", record: stamped, want: `{"log":"a"}`, stamped: true},
+		{name: "unstamped", record: `{"log":"a"}`, want: `{"log":"a"}`},
+		{name: "key only mentioned in a value", record: fmt.Sprintf(`{"log":%q}`, EventTimeKey), want: fmt.Sprintf(`{"log":%q}`, EventTimeKey)},
+		{name: "not an object", record: fmt.Sprintf(`%q`, EventTimeKey), want: fmt.Sprintf(`%q`, EventTimeKey)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			record, digest, ok := unstamp(rawRecords(tc.record)[0])
+			if string(record) != tc.want || ok != tc.stamped {
+				t.Errorf("expected %s stamped %t, got %s stamped %t", tc.want, tc.stamped, record, ok)
+			}
+			if ok && digest != sha256.Sum256([]byte(tc.record)) {
+				t.Error("expected the digest of the stamped record")
+			}
+		})
+	}
+
+	// the same message logged at another time isn't a duplicate, the same record sent again is
+	_, first, _ := unstamp(rawRecords(stamped)[0])
+	_, again, _ := unstamp(rawRecords(stamped)[0])
+	_, later, _ := unstamp(rawRecords(fmt.Sprintf(`{"log":"a",%q:"2.0"}`, EventTimeKey))[0])
+	if first != again || first == later {
+		t.Error("expected only the same stamped record to have the same digest")
+	}
+}
@@ -0,0 +1,377 @@
+package aggregator
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+const (
+	// forwardHostname is what the aggregator calls itself in the forward handshake
+	forwardHostname = "logging-plumber-log-aggregator"
+	// forwardIdleTimeout closes keepalive connections fluentd stopped using
+	forwardIdleTimeout = 5 * time.Minute
+)
+
+// errFaultInjected closes a forward connection on purpose
+var errFaultInjected = errors.New("fault injected")
+
+func init() {
+	msgpack.RegisterExt(0, (*eventTime)(nil))
+}
+
+// eventTime is the EventTime extension of the forward protocol, only decoded so that generic decoding
+// doesn't fail on it
+type eventTime struct {
+	seconds     uint32
+	nanoseconds uint32
+}
+
+func (t *eventTime) MarshalMsgpack() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, t.seconds)
+	binary.BigEndian.PutUint32(b[4:], t.nanoseconds)
+	return b, nil
+}
+
+func (t *eventTime) UnmarshalMsgpack(b []byte) error {
+	if len(b) != 8 {
+		return fmt.Errorf("event time of %d bytes", len(b))
+	}
+	t.seconds, t.nanoseconds = binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:])
+	return nil
+}
+
+// ServeForward accepts the fluent forward protocol on the listener, the tag of every event names
+// the index it goes to. It returns once the listener is closed.
+func (s *Server) ServeForward(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		go s.handleForward(conn)
+	}
+}
+
+// forwardSession is a single connection of a fluentd forward output
+type forwardSession struct {
+	conn    net.Conn
+	decoder *msgpack.Decoder
+	encoder *msgpack.Encoder
+	// testUID is the flowtest that authenticated in the handshake, only its indexes accept writes
+	testUID string
+}
+
+func (s *Server) handleForward(conn net.Conn) {
+	defer conn.Close()
+
+	session := &forwardSession{
+		conn:    conn,
+		decoder: msgpack.NewDecoder(bufio.NewReader(conn)),
+		encoder: msgpack.NewEncoder(conn),
+	}
+
+	if len(s.ingestionKey) > 0 {
+		if err := s.forwardHandshake(session); err != nil {
+			s.logger.Info("rejected forward connection", "remote", conn.RemoteAddr().String(), "reason", err.Error())
+			return
+		}
+	}
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(forwardIdleTimeout))
+		if err := s.receiveForward(session); err != nil {
+			if err != io.EOF && err != errFaultInjected {
+				s.logger.Error(err, "failed to receive forwarded events", "remote", conn.RemoteAddr().String())
+			}
+			return
+		}
+	}
+}
+
+// forwardHandshake runs the handshake of the forward protocol with user authentication, the username is the UID
+// of the flowtest and both the shared key and the password are its ingestion token
+func (s *Server) forwardHandshake(session *forwardSession) error {
+	nonce, authSalt := make([]byte, 16), make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	if _, err := rand.Read(authSalt); err != nil {
+		return err
+	}
+
+	_ = session.conn.SetDeadline(time.Now().Add(30 * time.Second))
+	defer session.conn.SetDeadline(time.Time{})
+
+	if err := session.encoder.Encode([]interface{}{"HELO", map[string]interface{}{
+		"nonce":     nonce,
+		"auth":      authSalt,
+		"keepalive": true,
+	}}); err != nil {
+		return err
+	}
+
+	// PING, client hostname, shared key salt, shared key digest, username, password digest
+	var message []interface{}
+	if err := session.decoder.Decode(&message); err != nil {
+		return fmt.Errorf("expected a PING: %w", err)
+	}
+	ping := make([]string, len(message))
+	for i, element := range message {
+		switch v := element.(type) {
+		case string:
+			ping[i] = v
+		case []byte:
+			ping[i] = string(v)
+		}
+	}
+	if len(ping) != 6 || ping[0] != "PING" {
+		// events sent without a handshake still name the index they were meant for
+		if len(ping) > 0 && ping[0] != "" && ping[0] != "PING" {
+			s.reject(ping[0], session.conn.RemoteAddr().String(), "write without credentials")
+		}
+		return fmt.Errorf("write without credentials")
+	}
+	hostname, sharedKeySalt, sharedKeyDigest, username, passwordDigest := ping[1], ping[2], ping[3], ping[4], ping[5]
+
+	token := IngestionToken(s.ingestionKey, username)
+	reason := ""
+	switch {
+	case username == "":
+		reason = "username is missing"
+	case sha512Hex(sharedKeySalt, hostname, string(nonce), token) != sharedKeyDigest:
+		reason = "shared key mismatch"
+	case sha512Hex(string(authSalt), username, token) != passwordDigest:
+		reason = "username/password mismatch"
+	}
+
+	if err := session.encoder.Encode([]interface{}{
+		"PONG", reason == "", reason, forwardHostname,
+		sha512Hex(sharedKeySalt, forwardHostname, string(nonce), token),
+	}); err != nil {
+		return err
+	}
+	if reason != "" {
+		return fmt.Errorf("%s", reason)
+	}
+	session.testUID = username
+	return nil
+}
+
+func sha512Hex(parts ...string) string {
+	digest := sha512.Sum512([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(digest[:])
+}
+
+// receiveForward reads a single message of any of the Message, Forward and PackedForward modes
+func (s *Server) receiveForward(session *forwardSession) error {
+	length, err := session.decoder.DecodeArrayLen()
+	if err != nil {
+		return err
+	}
+	if length < 2 {
+		return fmt.Errorf("forward message with %d elements", length)
+	}
+	tag, err := session.decoder.DecodeString()
+	if err != nil {
+		return err
+	}
+
+	code, err := session.decoder.PeekCode()
+	if err != nil {
+		return err
+	}
+
+	var entries [][]byte
+	var records []json.RawMessage
+	remaining := length - 2
+	switch {
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		// Forward mode, an array of [time, record] entries
+		n, err := session.decoder.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			record, err := decodeEntry(session.decoder)
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+	case msgpcode.IsBin(code) || msgpcode.IsString(code):
+		// PackedForward mode, entries come as a msgpack stream, decoded once the options are known
+		packed, err := session.decoder.DecodeBytes()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, packed)
+	default:
+		// Message mode, time and record of a single event
+		if remaining < 1 {
+			return fmt.Errorf("forward message without a record")
+		}
+		remaining--
+		if err := session.decoder.Skip(); err != nil {
+			return err
+		}
+		record, err := decodeRecord(session.decoder)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+
+	options := map[string]interface{}{}
+	if remaining > 0 {
+		if options, err = session.decoder.DecodeMap(); err != nil {
+			return err
+		}
+		for ; remaining > 1; remaining-- {
+			if err := session.decoder.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, packed := range entries {
+		unpacked, err := decodePackedEntries(packed, options["compressed"] == "gzip")
+		if err != nil {
+			return err
+		}
+		records = append(records, unpacked...)
+	}
+
+	authorized := session.testUID == "" || strings.HasPrefix(tag, session.testUID+"-")
+	if fault, ok := s.faults.active(tag, time.Now()); ok && authorized {
+		switch fault.Mode {
+		case FaultLatency:
+			time.Sleep(fault.Latency)
+			s.countFault(tag, 0)
+		case FaultDrop:
+			s.countFault(tag, len(records))
+			return session.ack(options)
+		default:
+			// there are no error responses in the protocol, fluentd only notices the missing ack
+			s.countFault(tag, 0)
+			return errFaultInjected
+		}
+	}
+
+	if !authorized {
+		s.reject(tag, session.conn.RemoteAddr().String(), fmt.Sprintf("write with the credentials of flowtest %s", session.testUID))
+	} else if err := s.add(tag, records); err != nil {
+		// without an ack fluentd sends the chunk again
+		return err
+	}
+
+	// the ack only confirms the chunk arrived, rejected events aren't worth retrying
+	return session.ack(options)
+}
+
+// ack answers the chunk option of a message when fluentd asked for it
+func (session *forwardSession) ack(options map[string]interface{}) error {
+	if chunk, ok := options["chunk"]; ok {
+		return session.encoder.Encode(map[string]interface{}{"ack": chunk})
+	}
+	return nil
+}
+
+// decodePackedEntries decodes the concatenated [time, record] entries of the PackedForward mode
+func decodePackedEntries(packed []byte, compressed bool) ([]json.RawMessage, error) {
+	var reader io.Reader = bytes.NewReader(packed)
+	if compressed {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		// CompressedPackedForward may hold several gzip members, gzip.Reader reads them all
+		unpacked, err := ioutil.ReadAll(io.LimitReader(gzipReader, maxBodySize))
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(unpacked)
+	}
+
+	decoder := msgpack.NewDecoder(reader)
+	var records []json.RawMessage
+	for {
+		record, err := decodeEntry(decoder)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// decodeEntry decodes a [time, record] entry, the time is dropped the same way the HTTP output drops it
+func decodeEntry(decoder *msgpack.Decoder) (json.RawMessage, error) {
+	n, err := decoder.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+	if n != 2 {
+		return nil, fmt.Errorf("forward entry with %d elements", n)
+	}
+	if err := decoder.Skip(); err != nil {
+		return nil, err
+	}
+	return decodeRecord(decoder)
+}
+
+// decodeRecord turns a msgpack record into the JSON the HTTP output would have sent
+func decodeRecord(decoder *msgpack.Decoder) (json.RawMessage, error) {
+	record, err := decoder.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonValue(record))
+}
+
+// jsonValue converts what msgpack decodes into something encoding/json handles, raw bytes are kept as text
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = jsonValue(nested)
+		}
+		return v
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			converted[fmt.Sprintf("%v", key)] = jsonValue(nested)
+		}
+		return converted
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = jsonValue(nested)
+		}
+		return v
+	default:
+		return v
+	}
+}
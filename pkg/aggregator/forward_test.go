@@ -0,0 +1,222 @@
+package aggregator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// forwardClient plays the fluentd forward output on one end of a pipe
+type forwardClient struct {
+	t       *testing.T
+	conn    net.Conn
+	decoder *msgpack.Decoder
+	encoder *msgpack.Encoder
+}
+
+func newForwardClient(t *testing.T, server *Server) *forwardClient {
+	serverConn, clientConn := net.Pipe()
+	go server.handleForward(serverConn)
+	_ = clientConn.SetDeadline(time.Now().Add(10 * time.Second))
+	t.Cleanup(func() { _ = clientConn.Close() })
+	return &forwardClient{t: t, conn: clientConn, decoder: msgpack.NewDecoder(clientConn), encoder: msgpack.NewEncoder(clientConn)}
+}
+
+// handshake answers the HELO and returns the PONG
+func (c *forwardClient) handshake(username string, password string) []interface{} {
+	var helo []interface{}
+	if err := c.decoder.Decode(&helo); err != nil {
+		c.t.Fatalf("expected a HELO: %v", err)
+	}
+	if len(helo) != 2 || helo[0] != "HELO" {
+		c.t.Fatalf("expected a HELO, got %v", helo)
+	}
+	options := helo[1].(map[string]interface{})
+	nonce, authSalt := string(options["nonce"].([]byte)), string(options["auth"].([]byte))
+
+	hostname, sharedKeySalt := "fluentd", "salt"
+	if err := c.encoder.Encode([]interface{}{
+		"PING", hostname, sharedKeySalt, sha512Hex(sharedKeySalt, hostname, nonce, password),
+		username, sha512Hex(authSalt, username, password),
+	}); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var pong []interface{}
+	if err := c.decoder.Decode(&pong); err != nil {
+		c.t.Fatalf("expected a PONG: %v", err)
+	}
+	return pong
+}
+
+// send writes a message and waits for the ack of its chunk
+func (c *forwardClient) send(chunk string, message ...interface{}) {
+	if err := c.encoder.Encode(message); err != nil {
+		c.t.Fatal(err)
+	}
+	var ack map[string]interface{}
+	if err := c.decoder.Decode(&ack); err != nil {
+		c.t.Fatalf("expected an ack of chunk %s: %v", chunk, err)
+	}
+	if ack["ack"] != chunk {
+		c.t.Fatalf("expected an ack of chunk %s, got %v", chunk, ack)
+	}
+}
+
+func packEntries(t *testing.T, records ...map[string]interface{}) []byte {
+	packed := new(bytes.Buffer)
+	encoder := msgpack.NewEncoder(packed)
+	for i, record := range records {
+		if err := encoder.Encode([]interface{}{&eventTime{seconds: uint32(1600000000 + i)}, record}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return packed.Bytes()
+}
+
+func TestForwardModes(t *testing.T) {
+	key := []byte("ingestion-key")
+	store := NewStore(Limits{})
+	client := newForwardClient(t, NewServer(store, nil, key, logr.Discard()))
+
+	pong := client.handshake("uid", IngestionToken(key, "uid"))
+	if len(pong) != 5 || pong[0] != "PONG" || pong[1] != true {
+		t.Fatalf("expected the handshake to succeed, got %v", pong)
+	}
+	if pong[3] != forwardHostname {
+		t.Errorf("expected the aggregator to introduce itself, got %v", pong)
+	}
+
+	// Message mode
+	client.send("c1", "uid-0-match", 1600000000, map[string]interface{}{"log": "message"}, map[string]interface{}{"chunk": "c1"})
+	// Forward mode
+	client.send("c2", "uid-1-match", []interface{}{
+		[]interface{}{1600000000, map[string]interface{}{"log": "forward 1"}},
+		[]interface{}{&eventTime{seconds: 1600000001}, map[string]interface{}{"log": "forward 2", "nested": map[string]interface{}{"a": 1}}},
+	}, map[string]interface{}{"chunk": "c2"})
+	// PackedForward mode
+	client.send("c3", "uid-2-match", packEntries(t, map[string]interface{}{"log": "packed 1"}, map[string]interface{}{"log": "packed 2"}),
+		map[string]interface{}{"chunk": "c3", "size": 2})
+	// CompressedPackedForward mode, made of two gzip members
+	compressed := new(bytes.Buffer)
+	for _, record := range []map[string]interface{}{{"log": "compressed 1"}, {"log": "compressed 2"}} {
+		writer := gzip.NewWriter(compressed)
+		if _, err := writer.Write(packEntries(t, record)); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.send("c4", "uid-3-match", compressed.Bytes(), map[string]interface{}{"chunk": "c4", "compressed": "gzip"})
+	// the tag of another flowtest is acknowledged but not kept
+	client.send("c5", "other-0-match", 1600000000, map[string]interface{}{"log": "other"}, map[string]interface{}{"chunk": "c5"})
+
+	for index, want := range map[string][]string{
+		"uid-0-match": {`{"log":"message"}`},
+		"uid-1-match": {`{"log":"forward 1"}`, `{"log":"forward 2","nested":{"a":1}}`},
+		"uid-2-match": {`{"log":"packed 1"}`, `{"log":"packed 2"}`},
+		"uid-3-match": {`{"log":"compressed 1"}`, `{"log":"compressed 2"}`},
+	} {
+		page, ok := store.Records(index, RecordQuery{Limit: 10})
+		if !ok {
+			t.Errorf("expected records on %s", index)
+			continue
+		}
+		var got []string
+		for _, record := range page.Records {
+			got = append(got, string(record))
+		}
+		if len(got) != len(want) {
+			t.Errorf("expected %v on %s, got %v", want, index, got)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("expected %v on %s, got %v", want, index, got)
+				break
+			}
+		}
+	}
+
+	if index, _ := store.Index("other-0-match"); index.LogCount != 0 || index.Rejected != 1 {
+		t.Errorf("expected the write to another flowtest to be rejected, got %+v", index)
+	}
+}
+
+func TestForwardHandshakeRejectsBadCredentials(t *testing.T) {
+	key := []byte("ingestion-key")
+
+	for _, tc := range []struct {
+		name     string
+		username string
+		password string
+		reason   string
+	}{
+		{name: "bad password", username: "uid", password: "wrong", reason: "shared key mismatch"},
+		{name: "token of another flowtest", username: "uid", password: IngestionToken(key, "other"), reason: "shared key mismatch"},
+		{name: "missing username", username: "", password: IngestionToken(key, ""), reason: "username is missing"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newForwardClient(t, NewServer(NewStore(Limits{}), nil, key, logr.Discard()))
+			pong := client.handshake(tc.username, tc.password)
+			if len(pong) != 5 || pong[1] != false || pong[2] != tc.reason {
+				t.Errorf("expected the handshake to fail with %q, got %v", tc.reason, pong)
+			}
+
+			// the aggregator hangs up right after the PONG
+			var next interface{}
+			if err := client.decoder.Decode(&next); err == nil {
+				t.Errorf("expected the connection to be closed, got %v", next)
+			}
+		})
+	}
+}
+
+func TestForwardPasswordDigest(t *testing.T) {
+	key := []byte("ingestion-key")
+	store := NewStore(Limits{})
+	server := NewServer(store, nil, key, logr.Discard())
+	client := newForwardClient(t, server)
+
+	var helo []interface{}
+	if err := client.decoder.Decode(&helo); err != nil {
+		t.Fatal(err)
+	}
+	options := helo[1].(map[string]interface{})
+	nonce := string(options["nonce"].([]byte))
+	token := IngestionToken(key, "uid")
+
+	// right shared key, wrong password digest
+	if err := client.encoder.Encode([]interface{}{
+		"PING", "fluentd", "salt", sha512Hex("salt", "fluentd", nonce, token), "uid", sha512Hex("other-salt", "uid", token),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var pong []interface{}
+	if err := client.decoder.Decode(&pong); err != nil {
+		t.Fatal(err)
+	}
+	if pong[1] != false || pong[2] != "username/password mismatch" {
+		t.Errorf("expected the password digest to be checked, got %v", pong)
+	}
+	if pong[4] != sha512Hex("salt", forwardHostname, nonce, token) {
+		t.Errorf("expected the PONG to carry the shared key digest of the aggregator, got %v", pong[4])
+	}
+}
+
+func TestForwardWithoutHandshake(t *testing.T) {
+	store := NewStore(Limits{})
+	client := newForwardClient(t, NewServer(store, nil, nil, logr.Discard()))
+
+	client.send("c1", "uid-0-match", 1600000000, map[string]interface{}{"log": "a"}, map[string]interface{}{"chunk": "c1"})
+
+	if index, _ := store.Index("uid-0-match"); index.LogCount != 1 {
+		t.Errorf("expected the record to be kept without an ingestion key, got %+v", index)
+	}
+}
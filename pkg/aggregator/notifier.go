@@ -0,0 +1,87 @@
+package aggregator
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// NotificationSignatureHeader carries the signature of a notification, the manager drops the ones it can't verify
+const NotificationSignatureHeader = "X-Plumber-Signature"
+
+// Notification is sent to the manager when an index receives its first records or its first rejected write
+type Notification struct {
+	Index string `json:"index"`
+}
+
+// Notifier posts notifications to the callback endpoint of the manager, the manager still polls
+// so a lost notification only delays a test
+type Notifier struct {
+	url string
+	// key signs the notifications, it's the ingestion key the manager shares with the aggregator
+	key    []byte
+	client *http.Client
+	logger logr.Logger
+}
+
+func NewNotifier(url string, key []byte, logger logr.Logger) *Notifier {
+	return &Notifier{
+		url:    url,
+		key:    key,
+		client: &http.Client{Timeout: 5 * time.Second},
+		logger: logger,
+	}
+}
+
+// NotificationSignature is the HMAC of the notification body with the ingestion key
+func NotificationSignature(key []byte, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify sends the notification in the background
+func (n *Notifier) Notify(index string) {
+	if n == nil || n.url == "" {
+		return
+	}
+	go func() {
+		for attempt := 1; attempt <= 3; attempt++ {
+			err := n.post(Notification{Index: index})
+			if err == nil {
+				return
+			}
+			n.logger.Error(err, "failed to notify the manager", "index", index, "attempt", attempt)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}()
+}
+
+func (n *Notifier) post(notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(NotificationSignatureHeader, NotificationSignature(n.key, body))
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("manager responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package aggregator
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestNotifierSignsNotifications(t *testing.T) {
+	key := []byte("ingestion-key")
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get(NotificationSignatureHeader)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	if err := NewNotifier(server.URL, key, logr.Discard()).post(Notification{Index: "uid-0-match"}); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"index":"uid-0-match"}` {
+		t.Errorf("expected the notification as the body, got %s", body)
+	}
+	if signature != NotificationSignature(key, body) {
+		t.Errorf("expected the body to be signed with the ingestion key, got %q", signature)
+	}
+	if signature == NotificationSignature([]byte("other"), body) {
+		t.Error("expected the signature to depend on the key")
+	}
+}
@@ -0,0 +1,139 @@
+package aggregator
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// indexesBucket holds the state of every index as JSON, keyed by name
+	indexesBucket = []byte("indexes")
+	// recordsBucket holds a nested bucket of records for every index, keyed by their sequence. Every record
+	// is prefixed with the time it was received on in unix nanoseconds.
+	recordsBucket = []byte("records")
+)
+
+// OpenStore creates a store that keeps everything in a bbolt database at path as well as in memory,
+// so the indexes survive a restart of the aggregator. The records already in the database are loaded.
+func OpenStore(path string, limits Limits) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the database: %w", err)
+	}
+
+	store := NewStore(limits)
+	store.db = db
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		indexes, err := tx.CreateBucketIfNotExists(indexesBucket)
+		if err != nil {
+			return err
+		}
+		records, err := tx.CreateBucketIfNotExists(recordsBucket)
+		if err != nil {
+			return err
+		}
+
+		return indexes.ForEach(func(name, state []byte) error {
+			idx := &index{}
+			if err := json.Unmarshal(state, &idx.Index); err != nil {
+				return fmt.Errorf("invalid state of index %s: %w", name, err)
+			}
+			if indexRecords := records.Bucket(name); indexRecords != nil {
+				if err := indexRecords.ForEach(func(key, value []byte) error {
+					if len(key) != 8 || len(value) < 8 {
+						return fmt.Errorf("invalid record of index %s", name)
+					}
+					record := storedRecord{
+						seq:      binary.BigEndian.Uint64(key),
+						received: time.Unix(0, int64(binary.BigEndian.Uint64(value))),
+						data:     append(json.RawMessage{}, value[8:]...),
+					}
+					idx.records = append(idx.records, record)
+					idx.bytes += len(record.data)
+					idx.lastSeq = record.seq
+					return nil
+				}); err != nil {
+					return err
+				}
+			}
+			store.indexes[string(name)] = idx
+			store.records += len(idx.records)
+			store.bytes += idx.bytes
+			return nil
+		})
+	})
+	if err == nil {
+		// the limits may have been lowered since the records were written
+		err = store.Expire(time.Now())
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Close closes the database of the store, if there is one
+func (s *Store) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// persist writes the changed states along with the records added to the index name and drops the evicted ones,
+// it's called with the lock held so the database follows the same order as the memory
+func (s *Store) persist(plan evictionPlan, name string, added []storedRecord) error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, state := range plan.states {
+			encoded, err := json.Marshal(state)
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket(indexesBucket).Put([]byte(state.Name), encoded); err != nil {
+				return err
+			}
+		}
+
+		if len(added) > 0 {
+			records, err := tx.Bucket(recordsBucket).CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+			for _, record := range added {
+				value := make([]byte, 8, 8+len(record.data))
+				binary.BigEndian.PutUint64(value, uint64(record.received.UnixNano()))
+				if err := records.Put(recordKey(record.seq), append(value, record.data...)); err != nil {
+					return err
+				}
+			}
+		}
+
+		for evictedFrom, evicted := range plan.evicted {
+			records := tx.Bucket(recordsBucket).Bucket([]byte(evictedFrom))
+			if records == nil {
+				continue
+			}
+			for _, record := range evicted {
+				if err := records.Delete(recordKey(record.seq)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func recordKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
@@ -0,0 +1,123 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// storedData returns the records kept for every index along with the sequence of the last one added
+func storedData(store *Store) (map[string][]string, map[string]uint64) {
+	records, lastSeq := map[string][]string{}, map[string]uint64{}
+	for name, idx := range store.indexes {
+		for _, record := range idx.records {
+			records[name] = append(records[name], string(record.data))
+		}
+		lastSeq[name] = idx.lastSeq
+	}
+	return records, lastSeq
+}
+
+func TestOpenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aggregator.db")
+	limits := Limits{MaxRecordsPerIndex: 2}
+
+	store, err := OpenStore(path, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("uid-0-match", rawRecords(`{"log":"a"}`, `{"log":"b"}`, `{"log":"c"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("uid-0-match", rawRecords(`{"log":"d"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("uid-1-match", rawRecords(`{"log":"e"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Fault("uid-1-match", 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Reject("uid-1-match"); err != nil {
+		t.Fatal(err)
+	}
+
+	indexes, err := json.Marshal(store.Indexes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, lastSeq := storedData(store)
+	stats := store.Stats()
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenStore(path, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	reopenedIndexes, err := json.Marshal(reopened.Indexes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reopenedIndexes) != string(indexes) {
+		t.Errorf("expected the indexes %s, got %s", indexes, reopenedIndexes)
+	}
+	reopenedRecords, reopenedLastSeq := storedData(reopened)
+	if !reflect.DeepEqual(reopenedRecords, records) {
+		t.Errorf("expected the records %v, got %v", records, reopenedRecords)
+	}
+	if !reflect.DeepEqual(reopenedLastSeq, lastSeq) {
+		t.Errorf("expected the last sequences %v, got %v", lastSeq, reopenedLastSeq)
+	}
+	if reopenedStats := reopened.Stats(); reopenedStats != stats {
+		t.Errorf("expected the stats %+v, got %+v", stats, reopenedStats)
+	}
+	if want := (map[string][]string{"uid-0-match": {`{"log":"c"}`, `{"log":"d"}`}, "uid-1-match": {`{"log":"e"}`}}); !reflect.DeepEqual(records, want) {
+		t.Errorf("expected the evicted records to be gone, got %v", records)
+	}
+
+	// records added after the restart carry on from the last sequence
+	if _, err := reopened.Add("uid-0-match", rawRecords(`{"log":"f"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if seq := reopened.indexes["uid-0-match"].records[1].seq; seq != lastSeq["uid-0-match"]+1 {
+		t.Errorf("expected the sequence %d, got %d", lastSeq["uid-0-match"]+1, seq)
+	}
+}
+
+func TestOpenStoreWithLowerLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aggregator.db")
+
+	store, err := OpenStore(path, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("uid-0-match", rawRecords(`{"log":"a"}`, `{"log":"b"}`, `{"log":"c"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the records over the lowered limit are evicted when the store is opened, and from the disk as well
+	for i := 0; i < 2; i++ {
+		reopened, err := OpenStore(path, Limits{MaxRecordsPerIndex: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, _ := storedData(reopened)
+		if want := (map[string][]string{"uid-0-match": {`{"log":"c"}`}}); !reflect.DeepEqual(records, want) {
+			t.Errorf("expected %v, got %v", want, records)
+		}
+		if index, _ := reopened.Index("uid-0-match"); index.Evicted != 2 {
+			t.Errorf("expected 2 evicted records, got %+v", index)
+		}
+		if err := reopened.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package aggregator
+
+import (
+	"sort"
+	"time"
+)
+
+// evictionPlan is a change of the store worked out before it's persisted, so memory and disk change together
+type evictionPlan struct {
+	// states holds the new state of every index that changes
+	states map[string]Index
+	// evicted holds the oldest records of every index that have to go
+	evicted map[string][]storedRecord
+}
+
+// planEvictions works out which records have to go to stay within the limits and the retention once the kept
+// records are added to target, target is nil when nothing is added
+func (s *Store) planEvictions(now time.Time, target *index, state Index, kept []storedRecord) evictionPlan {
+	plan := evictionPlan{states: map[string]Index{}, evicted: map[string][]storedRecord{}}
+
+	var targetRecords []storedRecord
+	keptBytes := 0
+	if target != nil {
+		plan.states[state.Name] = state
+		targetRecords = append(target.records[:len(target.records):len(target.records)], kept...)
+		for _, record := range kept {
+			keptBytes += len(record.data)
+		}
+	}
+	records := func(name string) []storedRecord {
+		if target != nil && name == state.Name {
+			return targetRecords
+		}
+		return s.indexes[name].records
+	}
+
+	count, size, evicted := map[string]int{}, map[string]int{}, map[string]int{}
+	names := make([]string, 0, len(s.indexes)+1)
+	for name, idx := range s.indexes {
+		names = append(names, name)
+		count[name], size[name] = len(idx.records), idx.bytes
+	}
+	if target != nil {
+		if _, ok := s.indexes[state.Name]; !ok {
+			names = append(names, state.Name)
+		}
+		count[state.Name], size[state.Name] = len(targetRecords), target.bytes+keptBytes
+	}
+	// ties between indexes are broken by name so the eviction doesn't depend on map order
+	sort.Strings(names)
+	totalCount, totalBytes := s.records+len(kept), s.bytes+keptBytes
+
+	evictOldest := func(name string) {
+		record := records(name)[evicted[name]]
+		evicted[name]++
+		count[name]--
+		size[name] -= len(record.data)
+		totalCount--
+		totalBytes -= len(record.data)
+
+		indexState, ok := plan.states[name]
+		if !ok {
+			indexState = s.indexes[name].Index
+		}
+		indexState.Evicted++
+		plan.states[name] = indexState
+		plan.evicted[name] = append(plan.evicted[name], record)
+	}
+
+	for _, name := range names {
+		for count[name] > 0 && ((s.limits.MaxRecordsPerIndex > 0 && count[name] > s.limits.MaxRecordsPerIndex) ||
+			(s.limits.MaxBytesPerIndex > 0 && size[name] > s.limits.MaxBytesPerIndex)) {
+			evictOldest(name)
+		}
+	}
+
+	if s.limits.Retention > 0 {
+		cutoff := now.Add(-s.limits.Retention)
+		for _, name := range names {
+			for count[name] > 0 && records(name)[evicted[name]].received.Before(cutoff) {
+				evictOldest(name)
+			}
+		}
+	}
+
+	for (s.limits.MaxRecords > 0 && totalCount > s.limits.MaxRecords) || (s.limits.MaxBytes > 0 && totalBytes > s.limits.MaxBytes) {
+		oldest := ""
+		for _, name := range names {
+			if count[name] == 0 {
+				continue
+			}
+			if oldest == "" || records(name)[evicted[name]].received.Before(records(oldest)[evicted[oldest]].received) {
+				oldest = name
+			}
+		}
+		if oldest == "" {
+			break
+		}
+		evictOldest(oldest)
+	}
+
+	return plan
+}
+
+// evict applies a persisted plan to the memory, the records added along with the plan have to be in place already
+func (s *Store) evict(plan evictionPlan) {
+	for name, state := range plan.states {
+		s.indexes[name].Index = state
+	}
+	for name, records := range plan.evicted {
+		idx := s.indexes[name]
+		for _, record := range records {
+			idx.bytes -= len(record.data)
+			s.bytes -= len(record.data)
+			if record.digest != nil {
+				if idx.seen[*record.digest]--; idx.seen[*record.digest] <= 0 {
+					delete(idx.seen, *record.digest)
+				}
+			}
+		}
+		s.records -= len(records)
+		// copied so the evicted records don't stay around in the backing array
+		idx.records = append([]storedRecord(nil), idx.records[len(records):]...)
+	}
+}
@@ -0,0 +1,149 @@
+package aggregator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// addReceived adds records to the index name as if they were received on received
+func addReceived(t *testing.T, store *Store, name string, received time.Time, records ...string) {
+	var lastSeq uint64
+	if idx, ok := store.indexes[name]; ok {
+		lastSeq = idx.lastSeq
+	}
+	if _, err := store.Add(name, rawRecords(records...)); err != nil {
+		t.Fatal(err)
+	}
+	for i, record := range store.indexes[name].records {
+		if record.seq > lastSeq {
+			store.indexes[name].records[i].received = received
+		}
+	}
+}
+
+func TestPlanEvictions(t *testing.T) {
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name    string
+		limits  Limits
+		adds    func(t *testing.T, store *Store)
+		expire  func(store *Store)
+		kept    map[string][]string
+		evicted map[string]int
+	}{
+		{
+			name:   "records per index",
+			limits: Limits{MaxRecordsPerIndex: 2},
+			adds: func(t *testing.T, store *Store) {
+				addReceived(t, store, "uid-0-match", now.Add(-3*time.Minute), `"a"`, `"b"`)
+				addReceived(t, store, "uid-0-match", now.Add(-2*time.Minute), `"c"`)
+				addReceived(t, store, "uid-1-match", now.Add(-time.Minute), `"d"`)
+			},
+			kept:    map[string][]string{"uid-0-match": {`"b"`, `"c"`}, "uid-1-match": {`"d"`}},
+			evicted: map[string]int{"uid-0-match": 1},
+		},
+		{
+			name:   "bytes per index",
+			limits: Limits{MaxBytesPerIndex: 10},
+			adds: func(t *testing.T, store *Store) {
+				addReceived(t, store, "uid-0-match", now.Add(-2*time.Minute), `"aaaa"`, `"bbbb"`)
+				addReceived(t, store, "uid-0-match", now.Add(-time.Minute), `"cc"`)
+			},
+			kept:    map[string][]string{"uid-0-match": {`"bbbb"`, `"cc"`}},
+			evicted: map[string]int{"uid-0-match": 1},
+		},
+		{
+			name:   "retention",
+			limits: Limits{Retention: time.Hour},
+			adds: func(t *testing.T, store *Store) {
+				addReceived(t, store, "uid-0-match", now.Add(-2*time.Hour), `"a"`)
+				addReceived(t, store, "uid-0-match", now.Add(-30*time.Minute), `"b"`)
+				addReceived(t, store, "uid-1-match", now.Add(-90*time.Minute), `"c"`)
+			},
+			expire:  func(store *Store) { _ = store.Expire(now) },
+			kept:    map[string][]string{"uid-0-match": {`"b"`}, "uid-1-match": {}},
+			evicted: map[string]int{"uid-0-match": 1, "uid-1-match": 1},
+		},
+		{
+			name:   "global records evict the oldest first",
+			limits: Limits{MaxRecords: 3},
+			adds: func(t *testing.T, store *Store) {
+				addReceived(t, store, "uid-1-match", now.Add(-3*time.Minute), `"a"`)
+				addReceived(t, store, "uid-0-match", now.Add(-2*time.Minute), `"b"`, `"c"`)
+				addReceived(t, store, "uid-1-match", now.Add(-time.Minute), `"d"`)
+			},
+			kept:    map[string][]string{"uid-0-match": {`"b"`, `"c"`}, "uid-1-match": {`"d"`}},
+			evicted: map[string]int{"uid-1-match": 1},
+		},
+		{
+			name:   "global bytes",
+			limits: Limits{MaxBytes: 12},
+			adds: func(t *testing.T, store *Store) {
+				addReceived(t, store, "uid-0-match", now.Add(-2*time.Minute), `"aaaa"`)
+				addReceived(t, store, "uid-1-match", now.Add(-time.Minute), `"bbbb"`, `"cc"`)
+			},
+			kept:    map[string][]string{"uid-0-match": {}, "uid-1-match": {`"bbbb"`, `"cc"`}},
+			evicted: map[string]int{"uid-0-match": 1},
+		},
+		{
+			name: "ties are broken by name",
+			adds: func(t *testing.T, store *Store) {
+				addReceived(t, store, "uid-1-match", now.Add(-time.Minute), `"a"`)
+				addReceived(t, store, "uid-0-match", now.Add(-time.Minute), `"b"`)
+			},
+			expire: func(store *Store) {
+				store.limits.MaxRecords = 1
+				_ = store.Expire(now)
+			},
+			kept:    map[string][]string{"uid-0-match": {}, "uid-1-match": {`"a"`}},
+			evicted: map[string]int{"uid-0-match": 1},
+		},
+		{
+			name: "expire after the limit per index is lowered",
+			adds: func(t *testing.T, store *Store) {
+				addReceived(t, store, "uid-0-match", now.Add(-2*time.Minute), `"a"`, `"b"`, `"c"`)
+				addReceived(t, store, "uid-1-match", now.Add(-time.Minute), `"d"`)
+			},
+			expire: func(store *Store) {
+				store.limits.MaxRecordsPerIndex = 1
+				_ = store.Expire(now)
+			},
+			kept:    map[string][]string{"uid-0-match": {`"c"`}, "uid-1-match": {`"d"`}},
+			evicted: map[string]int{"uid-0-match": 2},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewStore(tc.limits)
+			tc.adds(t, store)
+			if tc.expire != nil {
+				tc.expire(store)
+			}
+
+			kept := map[string][]string{}
+			totalRecords, totalBytes, totalEvicted := 0, 0, 0
+			for _, index := range store.Indexes() {
+				kept[index.Name] = []string{}
+				for _, record := range store.indexes[index.Name].records {
+					kept[index.Name] = append(kept[index.Name], string(record.data))
+					totalBytes += len(record.data)
+				}
+				totalRecords += len(kept[index.Name])
+				totalEvicted += index.Evicted
+				if index.Evicted != tc.evicted[index.Name] {
+					t.Errorf("expected %d evicted records on %s, got %d", tc.evicted[index.Name], index.Name, index.Evicted)
+				}
+				if index.Truncated() != (tc.evicted[index.Name] > 0) {
+					t.Errorf("expected %s to be truncated only when records were evicted", index.Name)
+				}
+			}
+			if !reflect.DeepEqual(kept, tc.kept) {
+				t.Errorf("expected %v to be kept, got %v", tc.kept, kept)
+			}
+			if stats := store.Stats(); stats.Records != totalRecords || stats.Bytes != totalBytes || stats.Evicted != totalEvicted {
+				t.Errorf("expected the stats to follow the evictions, got %+v", stats)
+			}
+		})
+	}
+}
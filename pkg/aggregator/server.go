@@ -0,0 +1,241 @@
+package aggregator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// APIPrefix is the prefix of the versioned query API, everything outside it accepts logs
+	APIPrefix = "/api/v1"
+
+	defaultPageSize = 50
+	maxPageSize     = 500
+	// maxBodySize caps a single flush of a fluentd buffer
+	maxBodySize = 16 << 20
+)
+
+// Server receives the logs shipped by the fluentd HTTP outputs of the slices
+type Server struct {
+	store    *Store
+	notifier *Notifier
+	logger   logr.Logger
+	// ingestionKey authenticates the writes, every write is accepted when it's empty
+	ingestionKey []byte
+	faults       *faultRegistry
+}
+
+// NewServer creates the server, notifier can be nil when the manager only polls
+func NewServer(store *Store, notifier *Notifier, ingestionKey []byte, logger logr.Logger) *Server {
+	return &Server{
+		store:        store,
+		notifier:     notifier,
+		ingestionKey: ingestionKey,
+		logger:       logger,
+		faults:       &faultRegistry{faults: map[string][]Fault{}},
+	}
+}
+
+// Handler serves both the query API and the ingestion of logs
+func (s *Server) Handler() http.Handler {
+	r := s.router()
+	// slices ship to <endpoint>/<slice name>/
+	r.PathPrefix("/").HandlerFunc(s.ingest).Methods(http.MethodPost, http.MethodPut)
+	return r
+}
+
+// APIHandler only serves the query API and the health check, for the plaintext listener when logs arrive over TLS
+func (s *Server) APIHandler() http.Handler {
+	return s.router()
+}
+
+func (s *Server) router() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/healthz", s.healthz).Methods(http.MethodGet)
+	r.HandleFunc(APIPrefix+"/stats", s.stats).Methods(http.MethodGet)
+	r.HandleFunc(APIPrefix+"/indexes", s.listIndexes).Methods(http.MethodGet)
+	r.HandleFunc(APIPrefix+"/indexes/{name}", s.getIndex).Methods(http.MethodGet)
+	r.HandleFunc(APIPrefix+"/indexes/{name}/records", s.listRecords).Methods(http.MethodGet)
+	r.HandleFunc(APIPrefix+"/faults/{uid}", s.setFaults).Methods(http.MethodPut)
+	return r
+}
+
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (s *Server) stats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.store.Stats())
+}
+
+func (s *Server) listIndexes(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.store.Indexes())
+}
+
+func (s *Server) getIndex(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	index, ok := s.store.Index(name)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("index %s not found", name)})
+		return
+	}
+	writeJSON(w, http.StatusOK, index)
+}
+
+// listRecords serves a page of records, it takes offset, limit, fields (comma separated) and q (text search)
+func (s *Server) listRecords(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	params := r.URL.Query()
+
+	query := RecordQuery{Limit: defaultPageSize, Search: params.Get("q")}
+	var err error
+	if offset := params.Get("offset"); offset != "" {
+		if query.Offset, err = strconv.Atoi(offset); err != nil || query.Offset < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "offset must be a positive number"})
+			return
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxPageSize {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", maxPageSize)})
+			return
+		}
+	}
+	if fields := params.Get("fields"); fields != "" {
+		query.Fields = strings.Split(fields, ",")
+	}
+
+	page, ok := s.store.Records(name, query)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("index %s not found", name)})
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) ingest(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(r.URL.Path, "/")
+	if name == "" {
+		http.Error(w, "index name is missing from the path", http.StatusBadRequest)
+		return
+	}
+
+	if len(s.ingestionKey) > 0 {
+		if err := authorize(s.ingestionKey, r, name); err != nil {
+			s.reject(name, r.RemoteAddr, err.Error())
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if s.injectHTTPFault(w, r, name) {
+		return
+	}
+
+	records, err := decodeRecords(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		s.logger.Error(err, "failed to decode records", "index", name)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.add(name, records); err != nil {
+		// fluentd retries the chunk
+		http.Error(w, "failed to store the records", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// add stores the records and notifies the manager about the first ones of the index
+func (s *Server) add(name string, records []json.RawMessage) error {
+	first, err := s.store.Add(name, records)
+	if err != nil {
+		s.logger.Error(err, "failed to store records", "index", name)
+		return err
+	}
+	if first {
+		s.notifier.Notify(name)
+	}
+	s.logger.V(1).Info("received records", "index", name, "count", len(records))
+	return nil
+}
+
+// reject counts a write that failed authentication and notifies the manager about the first one of the index
+func (s *Server) reject(name string, remote string, reason string) {
+	s.logger.Info("rejected write", "index", name, "remote", remote, "reason", reason)
+	first, err := s.store.Reject(name)
+	if err != nil {
+		s.logger.Error(err, "failed to count the rejected write", "index", name)
+		return
+	}
+	if first {
+		s.notifier.Notify(name)
+	}
+}
+
+// decodeRecords accepts both formats of the fluentd HTTP output, a JSON array when json_array is
+// enabled and newline delimited JSON otherwise
+func decodeRecords(body io.Reader) ([]json.RawMessage, error) {
+	reader := bufio.NewReader(body)
+
+	first, err := firstNonSpace(reader)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(reader)
+	if first == '[' {
+		var records []json.RawMessage
+		if err := decoder.Decode(&records); err != nil {
+			return nil, fmt.Errorf("invalid json array: %w", err)
+		}
+		return records, nil
+	}
+
+	var records []json.RawMessage
+	for {
+		var record json.RawMessage
+		if err := decoder.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid ndjson record #%d: %w", len(records), err)
+		}
+		records = append(records, record)
+	}
+}
+
+// firstNonSpace peeks the first meaningful byte without consuming it
+func firstNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			return b[0], nil
+		}
+		if _, err := reader.Discard(1); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
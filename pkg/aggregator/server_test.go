@@ -0,0 +1,58 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRecords(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty body", body: ""},
+		{name: "only whitespace", body: " \n\t"},
+		{name: "ndjson", body: "{\"a\":1}\n{\"b\":2}\n", want: []string{`{"a":1}`, `{"b":2}`}},
+		{name: "ndjson without trailing newline", body: `{"a":1}`, want: []string{`{"a":1}`}},
+		{name: "json array", body: `[{"a":1},{"b":2}]`, want: []string{`{"a":1}`, `{"b":2}`}},
+		{name: "json array after whitespace", body: "\n  [{\"a\":1}]", want: []string{`{"a":1}`}},
+		{name: "empty json array", body: `[]`, want: []string{}},
+		{name: "invalid ndjson record", body: "{\"a\":1}\n{\"b\":", wantErr: true},
+		{name: "unterminated json array", body: `[{"a":1}`, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := decodeRecords(strings.NewReader(tc.body))
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %s", records)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			if records != nil {
+				got = []string{}
+			}
+			for _, record := range records {
+				got = append(got, string(record))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func rawRecords(records ...string) []json.RawMessage {
+	raw := make([]json.RawMessage, 0, len(records))
+	for _, record := range records {
+		raw = append(raw, json.RawMessage(record))
+	}
+	return raw
+}
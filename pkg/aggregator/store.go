@@ -0,0 +1,325 @@
+package aggregator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store keeps the indexes and their records in memory, it's safe for concurrent use
+type Store struct {
+	limits Limits
+	// db keeps a copy on disk when the store was opened with OpenStore
+	db *bolt.DB
+
+	mu      sync.RWMutex
+	indexes map[string]*index
+	// records and bytes are what's kept over all the indexes
+	records int
+	bytes   int
+	// rejected counts the rejected writes to indexes that don't exist yet, anyone who reaches the aggregator can
+	// make up index names so these are only kept in memory and bounded by maxRejectedIndexes
+	rejected map[string]int
+}
+
+// maxRejectedIndexes bounds the unknown indexes rejected writes are counted for
+const maxRejectedIndexes = 1024
+
+type index struct {
+	Index
+	records []storedRecord
+	bytes   int
+	// lastSeq is the sequence of the last record added to the index
+	lastSeq uint64
+	// seen counts the kept records of every digest of the stamped records to tell duplicates apart, digests go
+	// along with the last of their records. It's only kept in memory.
+	seen map[[sha256.Size]byte]int
+}
+
+// storedRecord is a kept record, seq orders the records of an index and keys them on disk
+type storedRecord struct {
+	seq      uint64
+	received time.Time
+	data     json.RawMessage
+	// digest of the stamped record, nil for the records without a stamp
+	digest *[sha256.Size]byte
+}
+
+func NewStore(limits Limits) *Store {
+	return &Store{limits: limits, indexes: map[string]*index{}, rejected: map[string]int{}}
+}
+
+// newIndex starts an index, carrying over the writes to it that were rejected before it existed
+func (s *Store) newIndex(name string) *index {
+	return &index{Index: Index{Name: name, Rejected: s.rejected[name]}}
+}
+
+// Add records the received records on the given index, it reports whether these are the first records of the index.
+// Records are only acknowledged once they are on disk, so fluentd retries them when persisting fails.
+func (s *Store) Add(name string, records []json.RawMessage) (bool, error) {
+	if len(records) == 0 {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, ok := s.indexes[name]
+	if !ok {
+		idx = s.newIndex(name)
+	}
+
+	// the state only changes once it's persisted
+	now := time.Now()
+	state := idx.Index
+	first := state.LogCount == 0
+	if first {
+		state.FirstLog = now
+	}
+	if state.FirstAttempt.IsZero() {
+		state.FirstAttempt = now
+	}
+	state.LastLog = now
+	state.LogCount += len(records)
+
+	var kept []storedRecord
+	digests := map[[sha256.Size]byte]struct{}{}
+	seq := idx.lastSeq
+	for _, record := range records {
+		var digest *[sha256.Size]byte
+		if stripped, sum, ok := unstamp(record); ok {
+			record = stripped
+			_, inBatch := digests[sum]
+			if idx.seen[sum] > 0 || inBatch {
+				state.Duplicates++
+			}
+			digests[sum] = struct{}{}
+			digest = &sum
+		}
+		if s.limits.MaxRecordSize > 0 && len(record) > s.limits.MaxRecordSize {
+			state.Dropped++
+			continue
+		}
+		seq++
+		kept = append(kept, storedRecord{seq: seq, received: now, data: record, digest: digest})
+	}
+
+	plan := s.planEvictions(now, idx, state, kept)
+	if err := s.persist(plan, name, kept); err != nil {
+		return false, err
+	}
+
+	idx.lastSeq = seq
+	idx.records = append(idx.records, kept...)
+	for _, record := range kept {
+		idx.bytes += len(record.data)
+		s.bytes += len(record.data)
+		if record.digest != nil {
+			if idx.seen == nil {
+				idx.seen = map[[sha256.Size]byte]int{}
+			}
+			idx.seen[*record.digest]++
+		}
+	}
+	s.records += len(kept)
+	s.indexes[name] = idx
+	delete(s.rejected, name)
+	s.evict(plan)
+	return first, nil
+}
+
+// Fault counts a write to the index a fault was injected into, discarded is the number of its records that
+// were acknowledged and then thrown away
+func (s *Store) Fault(name string, discarded int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, ok := s.indexes[name]
+	if !ok {
+		idx = s.newIndex(name)
+	}
+	state := idx.Index
+	if state.FirstAttempt.IsZero() {
+		state.FirstAttempt = time.Now()
+	}
+	state.Faulted++
+	state.Discarded += discarded
+	if err := s.persist(evictionPlan{states: map[string]Index{name: state}}, name, nil); err != nil {
+		return err
+	}
+
+	idx.Index = state
+	s.indexes[name] = idx
+	delete(s.rejected, name)
+	return nil
+}
+
+// Expire evicts the records that outlived the retention, or that are over the limits after they were lowered
+func (s *Store) Expire(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan := s.planEvictions(now, nil, Index{}, nil)
+	if len(plan.evicted) == 0 {
+		return nil
+	}
+	if err := s.persist(plan, "", nil); err != nil {
+		return err
+	}
+	s.evict(plan)
+	return nil
+}
+
+// Reject counts a write to the index that failed authentication, it reports whether it's the first one
+// so the manager can be told about it right away
+func (s *Store) Reject(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, ok := s.indexes[name]
+	if !ok {
+		if _, counted := s.rejected[name]; !counted && len(s.rejected) >= maxRejectedIndexes {
+			return false, nil
+		}
+		s.rejected[name]++
+		return s.rejected[name] == 1, nil
+	}
+	state := idx.Index
+	state.Rejected++
+	if err := s.persist(evictionPlan{states: map[string]Index{name: state}}, name, nil); err != nil {
+		return false, err
+	}
+
+	idx.Index = state
+	s.indexes[name] = idx
+	return state.Rejected == 1, nil
+}
+
+// Stats sums up what the store keeps and what it let go of
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := Stats{Indexes: len(s.indexes), Records: s.records, Bytes: s.bytes}
+	for _, idx := range s.indexes {
+		stats.Dropped += idx.Dropped
+		stats.Evicted += idx.Evicted
+	}
+	return stats
+}
+
+// Indexes returns every index sorted by name
+func (s *Store) Indexes() []Index {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	indexes := make([]Index, 0, len(s.indexes)+len(s.rejected))
+	for _, idx := range s.indexes {
+		indexes = append(indexes, idx.Index)
+	}
+	for name, rejected := range s.rejected {
+		indexes = append(indexes, Index{Name: name, Rejected: rejected})
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Name < indexes[j].Name
+	})
+	return indexes
+}
+
+// Index returns the index with the given name
+func (s *Store) Index(name string) (Index, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx, ok := s.indexes[name]
+	if !ok {
+		rejected, ok := s.rejected[name]
+		return Index{Name: name, Rejected: rejected}, ok
+	}
+	return idx.Index, true
+}
+
+// Records returns a page of the records of the given index in the order they were received
+func (s *Store) Records(name string, query RecordQuery) (RecordPage, bool) {
+	s.mu.RLock()
+	idx, ok := s.indexes[name]
+	var records []storedRecord
+	if ok {
+		records = append(records, idx.records...)
+	}
+	s.mu.RUnlock()
+
+	page := RecordPage{Records: []json.RawMessage{}, Offset: query.Offset, Limit: query.Limit}
+	if !ok {
+		return page, false
+	}
+
+	search := strings.ToLower(query.Search)
+	for _, record := range records {
+		if search != "" && !bytes.Contains(bytes.ToLower(record.data), []byte(search)) {
+			continue
+		}
+		page.Total++
+		if page.Total <= query.Offset || len(page.Records) >= query.Limit {
+			continue
+		}
+		page.Records = append(page.Records, project(record.data, query.Fields))
+	}
+
+	return page, true
+}
+
+// project keeps only the given fields of the record, records that aren't objects are left as they are
+func project(record json.RawMessage, fields []string) json.RawMessage {
+	if len(fields) == 0 {
+		return record
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(record, &object); err != nil {
+		return record
+	}
+
+	projected := map[string]interface{}{}
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		value, ok := lookup(object, path)
+		if !ok {
+			continue
+		}
+		target := projected
+		for _, key := range path[:len(path)-1] {
+			next, ok := target[key].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				target[key] = next
+			}
+			target = next
+		}
+		target[path[len(path)-1]] = value
+	}
+
+	out, err := json.Marshal(projected)
+	if err != nil {
+		return record
+	}
+	return out
+}
+
+func lookup(object map[string]interface{}, path []string) (interface{}, bool) {
+	value, ok := object[path[0]]
+	if !ok || len(path) == 1 {
+		return value, ok
+	}
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookup(nested, path[1:])
+}
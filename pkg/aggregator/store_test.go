@@ -0,0 +1,245 @@
+package aggregator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreRecords(t *testing.T) {
+	store := NewStore(Limits{})
+	if _, err := store.Add("uid-0-match", rawRecords(
+		`{"log":"Hello","kubernetes":{"pod_name":"a","host":"node-1"}}`,
+		`{"log":"world","kubernetes":{"pod_name":"b"}}`,
+		`{"log":"hello again","level":"info"}`,
+		`"not an object"`,
+	)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query RecordQuery
+		want  []string
+		total int
+	}{
+		{
+			name:  "first page",
+			query: RecordQuery{Limit: 2},
+			want:  []string{`{"log":"Hello","kubernetes":{"pod_name":"a","host":"node-1"}}`, `{"log":"world","kubernetes":{"pod_name":"b"}}`},
+			total: 4,
+		},
+		{
+			name:  "second page",
+			query: RecordQuery{Offset: 2, Limit: 2},
+			want:  []string{`{"log":"hello again","level":"info"}`, `"not an object"`},
+			total: 4,
+		},
+		{
+			name:  "offset past the end",
+			query: RecordQuery{Offset: 10, Limit: 2},
+			want:  []string{},
+			total: 4,
+		},
+		{
+			name:  "case insensitive search",
+			query: RecordQuery{Limit: 10, Search: "HELLO"},
+			want:  []string{`{"log":"Hello","kubernetes":{"pod_name":"a","host":"node-1"}}`, `{"log":"hello again","level":"info"}`},
+			total: 2,
+		},
+		{
+			name:  "search is paged",
+			query: RecordQuery{Offset: 1, Limit: 10, Search: "hello"},
+			want:  []string{`{"log":"hello again","level":"info"}`},
+			total: 2,
+		},
+		{
+			name:  "projection",
+			query: RecordQuery{Limit: 10, Fields: []string{"log", "kubernetes.pod_name", "missing", "level.nested"}},
+			want: []string{
+				`{"kubernetes":{"pod_name":"a"},"log":"Hello"}`,
+				`{"kubernetes":{"pod_name":"b"},"log":"world"}`,
+				`{"log":"hello again"}`,
+				`"not an object"`,
+			},
+			total: 4,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			page, ok := store.Records("uid-0-match", tc.query)
+			if !ok {
+				t.Fatal("expected the index to be found")
+			}
+			got := []string{}
+			for _, record := range page.Records {
+				got = append(got, string(record))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+			if page.Total != tc.total {
+				t.Errorf("expected a total of %d, got %d", tc.total, page.Total)
+			}
+		})
+	}
+
+	if _, ok := store.Records("missing", RecordQuery{Limit: 10}); ok {
+		t.Error("expected a missing index not to be found")
+	}
+}
+
+func TestStoreAdd(t *testing.T) {
+	store := NewStore(Limits{MaxRecordSize: 20})
+
+	first, err := store.Add("uid-0-match", rawRecords(`{"log":"a"}`, `{"log":"way too large to be kept"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first {
+		t.Error("expected the first records of the index to be reported")
+	}
+	if first, _ := store.Add("uid-0-match", rawRecords(`{"log":"b"}`)); first {
+		t.Error("expected only the first records of the index to be reported")
+	}
+	if first, _ := store.Add("uid-0-match", nil); first {
+		t.Error("expected an empty write not to count")
+	}
+
+	index, _ := store.Index("uid-0-match")
+	if index.LogCount != 3 || index.Dropped != 1 || index.FirstLog.IsZero() || index.FirstAttempt.IsZero() {
+		t.Errorf("expected 3 records with 1 dropped, got %+v", index)
+	}
+	if stats := store.Stats(); stats.Records != 2 || stats.Dropped != 1 || stats.Indexes != 1 {
+		t.Errorf("expected 2 kept records, got %+v", stats)
+	}
+}
+
+func TestStoreDuplicates(t *testing.T) {
+	stamped := func(log string, eventTime string) string {
+		return fmt.Sprintf(`{"log":%q,%q:%q}`, log, EventTimeKey, eventTime)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		writes     [][]string
+		duplicates int
+		kept       int
+	}{
+		{
+			name:   "same message logged again",
+			writes: [][]string{{stamped("a", "1.0")}, {stamped("a", "2.0")}},
+			kept:   2,
+		},
+		{
+			name:       "write sent again",
+			writes:     [][]string{{stamped("a", "1.0"), stamped("b", "1.0")}, {stamped("a", "1.0"), stamped("b", "1.0")}},
+			duplicates: 2,
+			kept:       4,
+		},
+		{
+			name:       "duplicate within a write",
+			writes:     [][]string{{stamped("a", "1.0"), stamped("a", "1.0")}},
+			duplicates: 1,
+			kept:       2,
+		},
+		{
+			name:   "unstamped records aren't told apart",
+			writes: [][]string{{`{"log":"a"}`}, {`{"log":"a"}`}},
+			kept:   2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewStore(Limits{})
+			for _, write := range tc.writes {
+				if _, err := store.Add("uid-0-match", rawRecords(write...)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			index, _ := store.Index("uid-0-match")
+			if index.Duplicates != tc.duplicates {
+				t.Errorf("expected %d duplicates, got %d", tc.duplicates, index.Duplicates)
+			}
+			page, _ := store.Records("uid-0-match", RecordQuery{Limit: 10})
+			if page.Total != tc.kept {
+				t.Errorf("expected %d kept records, got %d", tc.kept, page.Total)
+			}
+			for _, record := range page.Records {
+				if strings.Contains(string(record), EventTimeKey) {
+					t.Errorf("expected %s to be removed from %s", EventTimeKey, record)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreReject(t *testing.T) {
+	store := NewStore(Limits{})
+
+	if first, _ := store.Reject("uid-0-match"); !first {
+		t.Error("expected the first rejected write to be reported")
+	}
+	if first, _ := store.Reject("uid-0-match"); first {
+		t.Error("expected only the first rejected write to be reported")
+	}
+	if index, ok := store.Index("uid-0-match"); !ok || index.Rejected != 2 {
+		t.Errorf("expected 2 rejected writes, got %+v", index)
+	}
+	if stats := store.Stats(); stats.Indexes != 0 {
+		t.Errorf("expected rejected writes not to create an index, got %+v", stats)
+	}
+
+	// the rejected writes are carried over once the index receives records
+	if _, err := store.Add("uid-0-match", rawRecords(`{"log":"a"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Reject("uid-0-match"); err != nil {
+		t.Fatal(err)
+	}
+	if index, _ := store.Index("uid-0-match"); index.LogCount != 1 || index.Rejected != 3 {
+		t.Errorf("expected 3 rejected writes, got %+v", index)
+	}
+
+	// made up index names stop being counted once there are too many of them
+	for i := 0; i < maxRejectedIndexes+10; i++ {
+		if _, err := store.Reject(fmt.Sprintf("made-up-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if indexes := store.Indexes(); len(indexes) != maxRejectedIndexes+1 {
+		t.Errorf("expected %d indexes, got %d", maxRejectedIndexes+1, len(indexes))
+	}
+	if _, ok := store.Index(fmt.Sprintf("made-up-%d", maxRejectedIndexes)); ok {
+		t.Error("expected the rejected writes over the bound to be left out")
+	}
+}
+
+func TestStoreDuplicatesEvicted(t *testing.T) {
+	stamped := func(log string) string {
+		return fmt.Sprintf(`{"log":%q,%q:"1.0"}`, log, EventTimeKey)
+	}
+	store := NewStore(Limits{MaxRecordsPerIndex: 2})
+
+	for _, log := range []string{"a", "b", "c", "d", "c"} {
+		if _, err := store.Add("uid-0-match", rawRecords(stamped(log))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the digests go along with the evicted records
+	idx := store.indexes["uid-0-match"]
+	if want := 2; len(idx.seen) != want {
+		t.Errorf("expected the digests of %d records, got %d", want, len(idx.seen))
+	}
+	if idx.Duplicates != 1 {
+		t.Errorf("expected 1 duplicate, got %d", idx.Duplicates)
+	}
+	store.limits.Retention = time.Nanosecond
+	if err := store.Expire(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.seen) != 0 {
+		t.Errorf("expected the digests of the expired records to be gone, got %d", len(idx.seen))
+	}
+}
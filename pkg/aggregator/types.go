@@ -0,0 +1,78 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Index is the state of the logs received on a single path, slices ship their logs to an index of their own name
+type Index struct {
+	Name     string    `json:"name"`
+	FirstLog time.Time `json:"first_log"`
+	LastLog  time.Time `json:"last_log"`
+	LogCount int       `json:"log_count"`
+	// Dropped counts the records that were received but not kept because they were too large
+	Dropped int `json:"dropped,omitempty"`
+	// Evicted counts the records that were kept for a while and then evicted to stay within the limits or the retention
+	Evicted int `json:"evicted,omitempty"`
+	// Rejected counts the writes to the index that failed authentication
+	Rejected int `json:"rejected,omitempty"`
+	// FirstAttempt is the first write to the index, including the ones a fault was injected into
+	FirstAttempt time.Time `json:"first_attempt"`
+	// Faulted counts the writes a fault was injected into
+	Faulted int `json:"faulted,omitempty"`
+	// Discarded counts the records that were acknowledged and then thrown away by a Drop fault
+	Discarded int `json:"discarded,omitempty"`
+	// Duplicates counts the records that arrived more than once, only records stamped with EventTimeKey are told apart
+	Duplicates int `json:"duplicates,omitempty"`
+}
+
+// Truncated tells whether some of the records the index received aren't kept anymore
+func (i Index) Truncated() bool {
+	return i.Dropped > 0 || i.Evicted > 0
+}
+
+// Limits bounds how much the aggregator keeps in memory, the oldest records are evicted first to make room
+// for new ones. Zero disables a limit.
+type Limits struct {
+	// MaxRecordsPerIndex is the number of records kept for every index
+	MaxRecordsPerIndex int
+	// MaxBytesPerIndex is the size in bytes of the records kept for every index
+	MaxBytesPerIndex int
+	// MaxRecords is the number of records kept over all the indexes
+	MaxRecords int
+	// MaxBytes is the size in bytes of the records kept over all the indexes
+	MaxBytes int
+	// MaxRecordSize is the size in bytes of the largest record that gets kept, larger ones are only counted
+	MaxRecordSize int
+	// Retention is how long a record is kept after it was received
+	Retention time.Duration
+}
+
+// Stats is the usage of the whole store
+type Stats struct {
+	Indexes int `json:"indexes"`
+	Records int `json:"records"`
+	Bytes   int `json:"bytes"`
+	Dropped int `json:"dropped"`
+	Evicted int `json:"evicted"`
+}
+
+// RecordQuery selects a page of the records of an index
+type RecordQuery struct {
+	Offset int
+	Limit  int
+	// Fields projects the records to the given keys, nested keys are separated by dots
+	Fields []string
+	// Search only matches records containing the text, case insensitive
+	Search string
+}
+
+// RecordPage is a page of the records of an index
+type RecordPage struct {
+	Records []json.RawMessage `json:"records"`
+	// Total is the number of kept records matching the query, not only the ones in the page
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
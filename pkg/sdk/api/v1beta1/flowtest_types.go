@@ -17,6 +17,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	flowv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -24,17 +25,94 @@ import (
 
 // FlowTestSpec defines the desired state of FlowTest
 type FlowTestSpec struct {
-	ReferencePod  ReferenceObject `json:"referencePod"`
-	ReferenceFlow ReferenceObject `json:"referenceFlow"`
-	SentMessages  []string        `json:"sentMessages"` // Try to use a config map here
+	ReferencePod ReferenceObject `json:"referencePod"`
+	// +optional
+	ReferenceFlow *ReferenceObject `json:"referenceFlow,omitempty"`
+	// InlineFlow is tested in place of the ReferenceFlow, so a Flow can be tested before it's applied,
+	// the slices are deployed to the namespace of the ReferencePod
+	// +optional
+	InlineFlow *flowv1beta1.FlowSpec `json:"inlineFlow,omitempty"`
+	// InlineClusterFlow is the ClusterFlow counterpart of InlineFlow,
+	// the slices are deployed to the control namespace of the Logging it refers to
+	// +optional
+	InlineClusterFlow *flowv1beta1.ClusterFlowSpec `json:"inlineClusterFlow,omitempty"`
+	// Comparison runs the inline flow as a candidate against the ReferenceFlow as the baseline,
+	// and reports which of the sent messages behave differently
+	// +optional
+	Comparison *ComparisonSpec `json:"comparison,omitempty"`
+	// ReferenceFlows are tested alongside the ReferenceFlow against the same simulation pod,
+	// for pods whose logs are routed through several flows at once
+	// +optional
+	ReferenceFlows []ReferenceObject `json:"referenceFlows,omitempty"`
+	// SentMessages are logged by the simulation pod one after the other, strings as they are and objects as JSON
+	// +kubebuilder:validation:MinItems=1
+	SentMessages []SentMessage `json:"sentMessages"`
+	// SlicingModes controls how the filters of the reference flow get sliced,
+	// Cumulative tests every prefix of the filter chain while Isolated tests each filter on its own
+	// +optional
+	// +kubebuilder:default:={"Cumulative"}
+	SlicingModes []SlicingMode `json:"slicingModes,omitempty"`
+	// OutputProtocol is the fluentd output plugin the slices ship their logs with,
+	// forward tests the buffering and the format of outputs to another fluentd.
+	// Forward is turned down for now, the forward output of logging-operator can't use TLS
+	// and the log aggregator doesn't take logs in plaintext
+	// +optional
+	// +kubebuilder:default:="http"
+	OutputProtocol OutputProtocol `json:"outputProtocol,omitempty"`
+	// Faults are injected by the log aggregator into the writes of the slices, the status then tells
+	// whether the logs still arrived, how late and whether some of them were duplicated
+	// +optional
+	Faults []FaultSpec `json:"faults,omitempty"`
+	// +optional
+	Simulator SimulatorSpec `json:"simulator,omitempty"`
 }
 
-// FlowTestStatus defines the observed state of FlowTest
-type FlowTestStatus struct {
+// FlowResults holds the test results of a single reference flow
+type FlowResults struct {
 	// +nullable
 	MatchStatus []bool `json:"matchStatus"`
 	// +nullable
 	FilterStatus []bool `json:"filterStatus"`
+	// +nullable
+	// +optional
+	IsolatedFilterStatus []bool `json:"isolatedFilterStatus,omitempty"`
+	// MatchResults replays the first-match-wins evaluation of the reference flow matches against the simulated pod
+	// +optional
+	MatchResults []MatchResult `json:"matchResults,omitempty"`
+	// PipelineStatus reports whether logs made it through all the matches and filters of the reference flow together
+	// +optional
+	PipelineStatus *bool `json:"pipelineStatus,omitempty"`
+	// DestinationHealth reports the outputs the reference flow actually ships logs to
+	// +optional
+	DestinationHealth []DestinationHealth `json:"destinationHealth,omitempty"`
+	// Logging is the name of the Logging resource whose fluentd ran the test
+	// +optional
+	Logging string `json:"logging,omitempty"`
+}
+
+// ReferenceFlowStatus holds the test results of one of the ReferenceFlows
+type ReferenceFlowStatus struct {
+	ReferenceObject `json:",inline"`
+	FlowResults     `json:",inline"`
+}
+
+// FlowTestStatus defines the observed state of FlowTest
+type FlowTestStatus struct {
+	// results of the ReferenceFlow
+	FlowResults `json:",inline"`
+	// ReferenceFlows holds the results of spec.referenceFlows in the same order
+	// +optional
+	ReferenceFlows []ReferenceFlowStatus `json:"referenceFlows,omitempty"`
+	// Comparison holds the results of the candidate and the per message differences to the baseline
+	// +optional
+	Comparison *ComparisonStatus `json:"comparison,omitempty"`
+	// Slices reports the outcome of every sliced flow, including the ones logging-operator rejected
+	// +optional
+	Slices []SliceStatus `json:"slices,omitempty"`
+	// UnreproducedMetadata lists the metadata of the reference pod the simulation pod couldn't mirror,
+	// so the kubernetes record of the simulated logs differs from the real one in these fields
+	// +optional
+	UnreproducedMetadata []UnreproducedMetadata `json:"unreproducedMetadata,omitempty"`
 	// +kubebuilder:default:="Created"
 	// +kubebuilder:validation:Enum=Created;Running;Completed;Error
 	Status FlowStatus `json:"status"`
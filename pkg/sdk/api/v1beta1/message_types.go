@@ -0,0 +1,65 @@
+package v1beta1
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// SentMessage is a message logged by the simulation pod, either a plain string logged as it is
+// or an object logged as a single line of JSON. A string spanning several lines is logged as a contiguous block.
+// +kubebuilder:validation:Type=""
+// +kubebuilder:pruning:PreserveUnknownFields
+type SentMessage struct {
+	// Raw is the message as JSON, the way it's written in the spec
+	Raw []byte `json:"-"`
+}
+
+// NewSentMessage returns a plain string message
+func NewSentMessage(line string) SentMessage {
+	raw, _ := json.Marshal(line)
+	return SentMessage{Raw: raw}
+}
+
+// MarshalJSON writes the message the way it was given
+func (m SentMessage) MarshalJSON() ([]byte, error) {
+	if len(m.Raw) == 0 {
+		return []byte("null"), nil
+	}
+	return m.Raw, nil
+}
+
+// UnmarshalJSON keeps the message the way it's given, strings and objects alike
+func (m *SentMessage) UnmarshalJSON(data []byte) error {
+	if !bytes.Equal(data, []byte("null")) {
+		m.Raw = append(m.Raw[0:0], data...)
+	}
+	return nil
+}
+
+// IsObject tells whether the message is logged as JSON
+func (m SentMessage) IsObject() bool {
+	trimmed := bytes.TrimSpace(m.Raw)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// String returns the line the simulation pod logs for the message
+func (m SentMessage) String() string {
+	var line string
+	if err := json.Unmarshal(m.Raw, &line); err == nil {
+		return line
+	}
+	compacted := new(bytes.Buffer)
+	if err := json.Compact(compacted, m.Raw); err != nil {
+		return string(m.Raw)
+	}
+	return compacted.String()
+}
+
+// Lines returns the lines the message is logged as, the trailing newline of a YAML block doesn't add an empty one
+func (m SentMessage) Lines() []string {
+	if m.IsObject() {
+		return []string{m.String()}
+	}
+	return strings.Split(strings.TrimSuffix(m.String(), "\n"), "\n")
+}
@@ -1,5 +1,10 @@
 package v1beta1
 
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
 // +kubebuilder:validation:Required
 type ReferenceObject struct {
 	Kind      string `json:"kind"`
@@ -15,3 +20,236 @@ const (
 	Completed FlowStatus = "Completed"
 	Error     FlowStatus = "Error"
 )
+
+// +kubebuilder:validation:Enum=Cumulative;Isolated
+type SlicingMode string
+
+const (
+	Cumulative SlicingMode = "Cumulative"
+	Isolated   SlicingMode = "Isolated"
+)
+
+// +kubebuilder:validation:Enum=http;forward
+type OutputProtocol string
+
+const (
+	HTTPProtocol    OutputProtocol = "http"
+	ForwardProtocol OutputProtocol = "forward"
+)
+
+// +kubebuilder:validation:Enum=ServerError;Latency;Drop;Unavailable
+type FaultMode string
+
+const (
+	ServerErrorFault FaultMode = "ServerError"
+	LatencyFault     FaultMode = "Latency"
+	DropFault        FaultMode = "Drop"
+	UnavailableFault FaultMode = "Unavailable"
+)
+
+// +kubebuilder:validation:Enum=Selected;Excluded;NotMatched;NotReached;Untestable
+type MatchOutcome string
+
+const (
+	Selected   MatchOutcome = "Selected"
+	Excluded   MatchOutcome = "Excluded"
+	NotMatched MatchOutcome = "NotMatched"
+	NotReached MatchOutcome = "NotReached"
+	Untestable MatchOutcome = "Untestable"
+)
+
+type MatchResult struct {
+	Outcome MatchOutcome `json:"outcome"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// DestinationHealth is the state of an output the reference flow ships its logs to
+type DestinationHealth struct {
+	ReferenceObject `json:",inline"`
+	Found           bool `json:"found"`
+	// Active, Problems and ProblemsCount are copied from the logging-operator status of the output
+	// +optional
+	Active *bool `json:"active,omitempty"`
+	// +optional
+	Problems []string `json:"problems,omitempty"`
+	// +optional
+	ProblemsCount int `json:"problemsCount,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Pending;Passing;ConfigRejected
+type SliceOutcome string
+
+const (
+	Pending        SliceOutcome = "Pending"
+	Passing        SliceOutcome = "Passing"
+	ConfigRejected SliceOutcome = "ConfigRejected"
+)
+
+// SliceStatus is the state of a single sliced flow deployed by the test
+type SliceStatus struct {
+	Name    string       `json:"name"`
+	Type    string       `json:"type"`
+	TestID  int          `json:"testId"`
+	Outcome SliceOutcome `json:"outcome"`
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Sample holds the first few records the slice delivered, as JSON, after all of its filters ran
+	// +optional
+	Sample []string `json:"sample,omitempty"`
+	// RejectedWrites counts the writes to the slice the log aggregator turned down for failing authentication
+	// +optional
+	RejectedWrites int `json:"rejectedWrites,omitempty"`
+	// Truncated is set once the log aggregator let go of some of the records of the slice, the sample and the
+	// records left in the aggregator are partial
+	// +optional
+	Truncated bool `json:"truncated,omitempty"`
+	// DroppedRecords counts the records of the slice the log aggregator didn't keep because they were too large
+	// +optional
+	DroppedRecords int `json:"droppedRecords,omitempty"`
+	// EvictedRecords counts the records of the slice the log aggregator evicted to stay within its limits or retention
+	// +optional
+	EvictedRecords int `json:"evictedRecords,omitempty"`
+	// Faults reports how the slice's output coped with the faults injected into it
+	// +optional
+	Faults *SliceFaultStatus `json:"faults,omitempty"`
+}
+
+// FaultSpec makes the log aggregator misbehave towards some of the slices, to test the buffering and the retries of their outputs
+type FaultSpec struct {
+	// Mode is ServerError (5xx responses), Latency (slow responses), Drop (accept and throw away) or
+	// Unavailable (connections closed without an answer)
+	Mode FaultMode `json:"mode"`
+	// SliceTypes limits the fault to the slices of the given types (match, filter, isolated-filter, pipeline, message),
+	// every slice when empty
+	// +optional
+	SliceTypes []string `json:"sliceTypes,omitempty"`
+	// StartAfter is when the fault starts, counted from the creation of the FlowTest
+	// +optional
+	StartAfter *metav1.Duration `json:"startAfter,omitempty"`
+	// Duration is how long the fault lasts, until the end of the test when empty
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// StatusCode is what ServerError faults answer with
+	// +optional
+	// +kubebuilder:validation:Minimum=500
+	// +kubebuilder:validation:Maximum=599
+	StatusCode int `json:"statusCode,omitempty"`
+	// Latency is added to every write by Latency faults
+	// +optional
+	Latency *metav1.Duration `json:"latency,omitempty"`
+}
+
+// SliceFaultStatus tells whether the logs of a slice made it through the injected faults
+type SliceFaultStatus struct {
+	// FaultedWrites counts the writes of the slice a fault was injected into
+	FaultedWrites int `json:"faultedWrites"`
+	// DiscardedRecords counts the records a Drop fault acknowledged and threw away
+	// +optional
+	DiscardedRecords int `json:"discardedRecords,omitempty"`
+	// Arrived tells whether records of the slice were kept despite the faults
+	Arrived bool `json:"arrived"`
+	// Lateness is how long after its first write attempt the first record of the slice was kept
+	// +optional
+	Lateness *metav1.Duration `json:"lateness,omitempty"`
+	// DuplicateRecords counts the records that arrived more than once, for example after a retry of a write that timed out
+	// +optional
+	DuplicateRecords int `json:"duplicateRecords,omitempty"`
+}
+
+// SimulatorSpec customizes the pod that simulates the reference pod
+type SimulatorSpec struct {
+	// PodTemplate is a partial PodTemplateSpec merged over the generated simulation pod,
+	// containers without a name apply to every simulator container
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+	// MirrorNode pins the simulation pod to the node of the reference pod, unless hosts matches need another node
+	// +optional
+	MirrorNode bool `json:"mirrorNode,omitempty"`
+	// EventDelay is the pause between two sent messages, the lines of a multi-line message are logged
+	// as a contiguous block without a pause, 3s by default
+	// +optional
+	EventDelay *metav1.Duration `json:"eventDelay,omitempty"`
+	// MessageDelays override the EventDelay after some of the sent messages
+	// +optional
+	MessageDelays []MessageDelay `json:"messageDelays,omitempty"`
+	// Emission schedules how often and how many times the sent messages are logged
+	// +optional
+	Emission *EmissionSpec `json:"emission,omitempty"`
+}
+
+// EmissionSpec schedules the sent messages, they are logged over and over every few seconds by default
+type EmissionSpec struct {
+	// Rate is the number of messages logged per second, it replaces the EventDelay and the MessageDelays
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Rate int `json:"rate,omitempty"`
+	// Burst is the number of messages logged back to back before every pause, 1 by default
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Burst int `json:"burst,omitempty"`
+	// Repetitions is how many times all the sent messages are logged before the simulator stops, so the logs
+	// can be counted exactly, they are logged until the test ends when empty
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Repetitions int `json:"repetitions,omitempty"`
+	// Jitter lengthens every pause by a random duration up to its own
+	// +optional
+	Jitter *metav1.Duration `json:"jitter,omitempty"`
+	// StartDelay is the pause before the first message is logged
+	// +optional
+	StartDelay *metav1.Duration `json:"startDelay,omitempty"`
+}
+
+// MessageDelay is the pause after a single sent message
+type MessageDelay struct {
+	// Message is the index of the sent message in spec.sentMessages
+	// +kubebuilder:validation:Minimum=0
+	Message int             `json:"message"`
+	Delay   metav1.Duration `json:"delay"`
+}
+
+// UnreproducedMetadata is a part of the kubernetes metadata of the reference pod that the simulation pod doesn't share
+type UnreproducedMetadata struct {
+	// Field is the key of the kubernetes record that differs, like kubernetes.host
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ComparisonSpec configures how the baseline and the candidate flows are compared
+type ComparisonSpec struct {
+	// MessageKey is the record key holding the raw log line before any filter runs,
+	// it's used to tell the sent messages apart
+	// +optional
+	// +kubebuilder:default:="log"
+	MessageKey string `json:"messageKey,omitempty"`
+}
+
+// ComparisonStatus is the outcome of running the candidate flow against the baseline flow
+type ComparisonStatus struct {
+	// Candidate holds the slice results of the inline flow, the baseline results stay at the top of the status
+	Candidate FlowResults `json:"candidate"`
+	// +optional
+	Messages []MessageComparison `json:"messages,omitempty"`
+	// BaselineDeliveredAt is when the baseline was first seen delivering every message, the candidate gets
+	// a while from then on to deliver the rest before its missing messages are reported
+	// +optional
+	BaselineDeliveredAt *metav1.Time `json:"baselineDeliveredAt,omitempty"`
+}
+
+// MessageComparison tells whether a sent message behaves differently under the candidate flow
+type MessageComparison struct {
+	Message            string `json:"message"`
+	BaselineDelivered  bool   `json:"baselineDelivered"`
+	CandidateDelivered bool   `json:"candidateDelivered"`
+	DeliveryChanged    bool   `json:"deliveryChanged"`
+	// RecordChanged stays empty until the records delivered by both flows are known
+	// +optional
+	RecordChanged *bool `json:"recordChanged,omitempty"`
+	// Diff describes how the delivered records differ
+	// +optional
+	Diff string `json:"diff,omitempty"`
+}
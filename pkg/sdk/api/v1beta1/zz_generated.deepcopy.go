@@ -5,9 +5,186 @@
 package v1beta1
 
 import (
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	apiv1beta1 "github.com/banzaicloud/logging-operator/pkg/sdk/api/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComparisonSpec) DeepCopyInto(out *ComparisonSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComparisonSpec.
+func (in *ComparisonSpec) DeepCopy() *ComparisonSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ComparisonSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComparisonStatus) DeepCopyInto(out *ComparisonStatus) {
+	*out = *in
+	in.Candidate.DeepCopyInto(&out.Candidate)
+	if in.Messages != nil {
+		in, out := &in.Messages, &out.Messages
+		*out = make([]MessageComparison, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BaselineDeliveredAt != nil {
+		in, out := &in.BaselineDeliveredAt, &out.BaselineDeliveredAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComparisonStatus.
+func (in *ComparisonStatus) DeepCopy() *ComparisonStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ComparisonStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DestinationHealth) DeepCopyInto(out *DestinationHealth) {
+	*out = *in
+	out.ReferenceObject = in.ReferenceObject
+	if in.Active != nil {
+		in, out := &in.Active, &out.Active
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Problems != nil {
+		in, out := &in.Problems, &out.Problems
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DestinationHealth.
+func (in *DestinationHealth) DeepCopy() *DestinationHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(DestinationHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmissionSpec) DeepCopyInto(out *EmissionSpec) {
+	*out = *in
+	if in.Jitter != nil {
+		in, out := &in.Jitter, &out.Jitter
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.StartDelay != nil {
+		in, out := &in.StartDelay, &out.StartDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmissionSpec.
+func (in *EmissionSpec) DeepCopy() *EmissionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EmissionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FaultSpec) DeepCopyInto(out *FaultSpec) {
+	*out = *in
+	if in.SliceTypes != nil {
+		in, out := &in.SliceTypes, &out.SliceTypes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartAfter != nil {
+		in, out := &in.StartAfter, &out.StartAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Latency != nil {
+		in, out := &in.Latency, &out.Latency
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FaultSpec.
+func (in *FaultSpec) DeepCopy() *FaultSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FaultSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlowResults) DeepCopyInto(out *FlowResults) {
+	*out = *in
+	if in.MatchStatus != nil {
+		in, out := &in.MatchStatus, &out.MatchStatus
+		*out = make([]bool, len(*in))
+		copy(*out, *in)
+	}
+	if in.FilterStatus != nil {
+		in, out := &in.FilterStatus, &out.FilterStatus
+		*out = make([]bool, len(*in))
+		copy(*out, *in)
+	}
+	if in.IsolatedFilterStatus != nil {
+		in, out := &in.IsolatedFilterStatus, &out.IsolatedFilterStatus
+		*out = make([]bool, len(*in))
+		copy(*out, *in)
+	}
+	if in.MatchResults != nil {
+		in, out := &in.MatchResults, &out.MatchResults
+		*out = make([]MatchResult, len(*in))
+		copy(*out, *in)
+	}
+	if in.PipelineStatus != nil {
+		in, out := &in.PipelineStatus, &out.PipelineStatus
+		*out = new(bool)
+		**out = **in
+	}
+	if in.DestinationHealth != nil {
+		in, out := &in.DestinationHealth, &out.DestinationHealth
+		*out = make([]DestinationHealth, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlowResults.
+func (in *FlowResults) DeepCopy() *FlowResults {
+	if in == nil {
+		return nil
+	}
+	out := new(FlowResults)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FlowTest) DeepCopyInto(out *FlowTest) {
 	*out = *in
@@ -71,12 +248,51 @@ func (in *FlowTestList) DeepCopyObject() runtime.Object {
 func (in *FlowTestSpec) DeepCopyInto(out *FlowTestSpec) {
 	*out = *in
 	out.ReferencePod = in.ReferencePod
-	out.ReferenceFlow = in.ReferenceFlow
+	if in.ReferenceFlow != nil {
+		in, out := &in.ReferenceFlow, &out.ReferenceFlow
+		*out = new(ReferenceObject)
+		**out = **in
+	}
+	if in.InlineFlow != nil {
+		in, out := &in.InlineFlow, &out.InlineFlow
+		*out = new(apiv1beta1.FlowSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InlineClusterFlow != nil {
+		in, out := &in.InlineClusterFlow, &out.InlineClusterFlow
+		*out = new(apiv1beta1.ClusterFlowSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Comparison != nil {
+		in, out := &in.Comparison, &out.Comparison
+		*out = new(ComparisonSpec)
+		**out = **in
+	}
+	if in.ReferenceFlows != nil {
+		in, out := &in.ReferenceFlows, &out.ReferenceFlows
+		*out = make([]ReferenceObject, len(*in))
+		copy(*out, *in)
+	}
 	if in.SentMessages != nil {
 		in, out := &in.SentMessages, &out.SentMessages
-		*out = make([]string, len(*in))
+		*out = make([]SentMessage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SlicingModes != nil {
+		in, out := &in.SlicingModes, &out.SlicingModes
+		*out = make([]SlicingMode, len(*in))
 		copy(*out, *in)
 	}
+	if in.Faults != nil {
+		in, out := &in.Faults, &out.Faults
+		*out = make([]FaultSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Simulator.DeepCopyInto(&out.Simulator)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlowTestSpec.
@@ -92,14 +308,29 @@ func (in *FlowTestSpec) DeepCopy() *FlowTestSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FlowTestStatus) DeepCopyInto(out *FlowTestStatus) {
 	*out = *in
-	if in.MatchStatus != nil {
-		in, out := &in.MatchStatus, &out.MatchStatus
-		*out = make([]bool, len(*in))
-		copy(*out, *in)
+	in.FlowResults.DeepCopyInto(&out.FlowResults)
+	if in.ReferenceFlows != nil {
+		in, out := &in.ReferenceFlows, &out.ReferenceFlows
+		*out = make([]ReferenceFlowStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
-	if in.FilterStatus != nil {
-		in, out := &in.FilterStatus, &out.FilterStatus
-		*out = make([]bool, len(*in))
+	if in.Comparison != nil {
+		in, out := &in.Comparison, &out.Comparison
+		*out = new(ComparisonStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Slices != nil {
+		in, out := &in.Slices, &out.Slices
+		*out = make([]SliceStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.UnreproducedMetadata != nil {
+		in, out := &in.UnreproducedMetadata, &out.UnreproducedMetadata
+		*out = make([]UnreproducedMetadata, len(*in))
 		copy(*out, *in)
 	}
 }
@@ -114,6 +345,74 @@ func (in *FlowTestStatus) DeepCopy() *FlowTestStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MatchResult) DeepCopyInto(out *MatchResult) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MatchResult.
+func (in *MatchResult) DeepCopy() *MatchResult {
+	if in == nil {
+		return nil
+	}
+	out := new(MatchResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MessageComparison) DeepCopyInto(out *MessageComparison) {
+	*out = *in
+	if in.RecordChanged != nil {
+		in, out := &in.RecordChanged, &out.RecordChanged
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MessageComparison.
+func (in *MessageComparison) DeepCopy() *MessageComparison {
+	if in == nil {
+		return nil
+	}
+	out := new(MessageComparison)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MessageDelay) DeepCopyInto(out *MessageDelay) {
+	*out = *in
+	out.Delay = in.Delay
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MessageDelay.
+func (in *MessageDelay) DeepCopy() *MessageDelay {
+	if in == nil {
+		return nil
+	}
+	out := new(MessageDelay)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferenceFlowStatus) DeepCopyInto(out *ReferenceFlowStatus) {
+	*out = *in
+	out.ReferenceObject = in.ReferenceObject
+	in.FlowResults.DeepCopyInto(&out.FlowResults)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceFlowStatus.
+func (in *ReferenceFlowStatus) DeepCopy() *ReferenceFlowStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferenceFlowStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReferenceObject) DeepCopyInto(out *ReferenceObject) {
 	*out = *in
@@ -128,3 +427,118 @@ func (in *ReferenceObject) DeepCopy() *ReferenceObject {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SentMessage) DeepCopyInto(out *SentMessage) {
+	*out = *in
+	if in.Raw != nil {
+		in, out := &in.Raw, &out.Raw
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SentMessage.
+func (in *SentMessage) DeepCopy() *SentMessage {
+	if in == nil {
+		return nil
+	}
+	out := new(SentMessage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SimulatorSpec) DeepCopyInto(out *SimulatorSpec) {
+	*out = *in
+	if in.PodTemplate != nil {
+		in, out := &in.PodTemplate, &out.PodTemplate
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EventDelay != nil {
+		in, out := &in.EventDelay, &out.EventDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MessageDelays != nil {
+		in, out := &in.MessageDelays, &out.MessageDelays
+		*out = make([]MessageDelay, len(*in))
+		copy(*out, *in)
+	}
+	if in.Emission != nil {
+		in, out := &in.Emission, &out.Emission
+		*out = new(EmissionSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SimulatorSpec.
+func (in *SimulatorSpec) DeepCopy() *SimulatorSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SimulatorSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SliceFaultStatus) DeepCopyInto(out *SliceFaultStatus) {
+	*out = *in
+	if in.Lateness != nil {
+		in, out := &in.Lateness, &out.Lateness
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SliceFaultStatus.
+func (in *SliceFaultStatus) DeepCopy() *SliceFaultStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SliceFaultStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SliceStatus) DeepCopyInto(out *SliceStatus) {
+	*out = *in
+	if in.Sample != nil {
+		in, out := &in.Sample, &out.Sample
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Faults != nil {
+		in, out := &in.Faults, &out.Faults
+		*out = new(SliceFaultStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SliceStatus.
+func (in *SliceStatus) DeepCopy() *SliceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SliceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UnreproducedMetadata) DeepCopyInto(out *UnreproducedMetadata) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UnreproducedMetadata.
+func (in *UnreproducedMetadata) DeepCopy() *UnreproducedMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(UnreproducedMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -2,6 +2,7 @@ package webserver
 
 import (
 	"embed"
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"net/http"
@@ -10,6 +11,11 @@ import (
 	"os"
 	"path"
 	"strings"
+
+	"github.com/gorilla/mux"
+	loggingpipelineplumberv1beta1 "github.com/mrsupiri/logging-pipeline-plumber/pkg/sdk/api/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 //go:embed build/*
@@ -51,3 +57,37 @@ func (ws *WebServer) ProxyToKubeAPI(res http.ResponseWriter, req *http.Request)
 	ws.logger.V(1).Info(fmt.Sprintf("proxying %s to %s", req.URL, targetUrl))
 	proxy.ServeHTTP(res, req)
 }
+
+// GetComparison returns the per message differences between the baseline and the candidate flow of a FlowTest
+func (ws *WebServer) GetComparison(res http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+
+	var flowTest loggingpipelineplumberv1beta1.FlowTest
+	if err := ws.client.Get(req.Context(), types.NamespacedName{Namespace: vars["namespace"], Name: vars["name"]}, &flowTest); err != nil {
+		if apierrors.IsNotFound(err) {
+			ws.writeJSON(res, http.StatusNotFound, HTTPResponse{Error: &HTTPError{Error: "flowtest not found", Message: err.Error()}})
+			return
+		}
+		ws.logger.Error(err, "failed to get the flowtest", "namespace", vars["namespace"], "name", vars["name"])
+		ws.writeJSON(res, http.StatusInternalServerError, HTTPResponse{Error: &HTTPError{Error: "failed to get the flowtest", Message: err.Error()}})
+		return
+	}
+
+	if flowTest.Status.Comparison == nil {
+		ws.writeJSON(res, http.StatusNotFound, HTTPResponse{Error: &HTTPError{Error: "flowtest is not running in comparison mode"}})
+		return
+	}
+
+	ws.writeJSON(res, http.StatusOK, HTTPResponse{Data: &HTTPData{
+		Message: fmt.Sprintf("comparison of %s/%s", flowTest.ObjectMeta.Namespace, flowTest.ObjectMeta.Name),
+		Info:    flowTest.Status.Comparison,
+	}})
+}
+
+func (ws *WebServer) writeJSON(res http.ResponseWriter, status int, body HTTPResponse) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	if err := json.NewEncoder(res).Encode(body); err != nil {
+		ws.logger.Error(err, "failed to write the response")
+	}
+}
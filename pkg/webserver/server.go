@@ -12,12 +12,15 @@ import (
 	"net/http"
 	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type WebServer struct {
 	port      string
 	logger    logr.Logger
 	kubeProxy KubeProxy
+	// client reads FlowTests for the API endpoints
+	client client.Reader
 }
 type KubeProxy struct {
 	endpoint       string
@@ -31,7 +34,7 @@ const (
 )
 
 // NewWebServer returns an HTTP webserver that handles webhooks
-func NewWebServer(port string) *WebServer {
+func NewWebServer(port string, reader client.Reader) *WebServer {
 	logger := ctrl.Log.WithName("web-webserver")
 
 	// Setup proxy data
@@ -62,6 +65,7 @@ func NewWebServer(port string) *WebServer {
 	return &WebServer{
 		port:   port,
 		logger: logger,
+		client: reader,
 		kubeProxy: KubeProxy{
 			endpoint: "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")),
 			token:    string(token),
@@ -75,6 +79,7 @@ func NewWebServer(port string) *WebServer {
 func (ws *WebServer) ListenAndServe(stopCh <-chan struct{}) {
 	r := mux.NewRouter()
 	r.PathPrefix("/k8s").HandlerFunc(ws.ProxyToKubeAPI)
+	r.HandleFunc("/api/v1/flowtests/{namespace}/{name}/comparison", ws.GetComparison).Methods(http.MethodGet)
 	r.PathPrefix("/").Handler(clientHandler())
 
 	corsOpts := cors.New(cors.Options{
@@ -2,17 +2,64 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
+// messageDelays overrides the delay after some of the messages, given as index=duration
+type messageDelays map[int]time.Duration
+
+func (d messageDelays) String() string {
+	var delays []string
+	for i, delay := range d {
+		delays = append(delays, fmt.Sprintf("%d=%s", i, delay))
+	}
+	return strings.Join(delays, ",")
+}
+
+func (d messageDelays) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("%s isn't index=duration", value)
+	}
+	i, err := strconv.Atoi(parts[0])
+	if err != nil || i < 0 {
+		return fmt.Errorf("invalid message index %s", parts[0])
+	}
+	delay, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return err
+	}
+	d[i] = delay
+	return nil
+}
+
 func main() {
 	var logDir string
+	var format string
 	var echoDelay time.Duration
+	var rate, burst, repetitions int
+	var jitter, startDelay time.Duration
+	delays := messageDelays{}
 	flag.DurationVar(&echoDelay, "delay", 3*time.Second, "interval between 2 log echos")
+	flag.Var(delays, "message_delay", "index=duration overriding the delay after a single message, can be repeated")
 	flag.StringVar(&logDir, "log_file", "", "absolute path for the log file")
+	flag.IntVar(&rate, "rate", 0, "messages echoed per second, replaces -delay and -message_delay when set")
+	flag.IntVar(&burst, "burst", 1, "messages echoed back to back before every pause")
+	flag.IntVar(&repetitions, "repetitions", 0, "times all the messages are echoed before stopping, 0 to never stop")
+	flag.DurationVar(&jitter, "jitter", 0, "random duration up to which every pause is lengthened")
+	flag.DurationVar(&startDelay, "start_delay", 0, "pause before the first echo")
+	flag.StringVar(&format, "format", "text", "text echos the log file line by line, json reads it as a JSON array of messages, echos objects as single-line JSON and multi-line strings as a single block")
 	flag.Parse()
 
 	if len(logDir) == 0 {
@@ -21,6 +68,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	if format != "text" && format != "json" {
+		fmt.Printf("unknown format %s, use text or json\n", format)
+		os.Exit(1)
+	}
+
+	if rate < 0 || burst < 1 || repetitions < 0 || jitter < 0 || startDelay < 0 {
+		fmt.Println("-rate, -repetitions, -jitter and -start_delay can't be negative and -burst has to be at least 1")
+		os.Exit(1)
+	}
+
 	// Source - https://www.geeksforgeeks.org/how-to-read-a-file-line-by-line-to-string-in-golang/
 
 	// os.Open() opens specific file in
@@ -46,8 +103,14 @@ func main() {
 	scanner.Split(bufio.ScanLines)
 	var text []string
 
-	for scanner.Scan() {
-		text = append(text, scanner.Text())
+	if format == "json" {
+		if text, err = readMessages(file); err != nil {
+			panic(fmt.Sprintf("failed to read messages from %s: %s", logDir, err))
+		}
+	} else {
+		for scanner.Scan() {
+			text = append(text, scanner.Text())
+		}
 	}
 
 	// The method os.File.Close() is called
@@ -56,10 +119,81 @@ func main() {
 
 	// ------------------------------------------------------------------------------------------
 
-	for {
-		for _, line := range text {
-			fmt.Println(line)
-			time.Sleep(echoDelay)
+	rand.Seed(time.Now().UnixNano())
+	time.Sleep(startDelay)
+
+	emission := schedule{delay: echoDelay, delays: delays, rate: rate, burst: burst, repetitions: repetitions, jitter: jitter}
+	emission.echo(os.Stdout, text, time.Sleep)
+
+	// exiting would restart the container and echo everything again, so wait to be stopped
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	<-stop
+}
+
+// schedule is how the messages are echoed
+type schedule struct {
+	delay       time.Duration
+	delays      messageDelays
+	rate        int
+	burst       int
+	repetitions int
+	jitter      time.Duration
+}
+
+// pause is the pause after a burst that ended with the message i
+func (s schedule) pause(i int) time.Duration {
+	delay := s.delay
+	if s.rate > 0 {
+		delay = time.Duration(s.burst) * time.Second / time.Duration(s.rate)
+	} else if messageDelay, ok := s.delays[i]; ok {
+		delay = messageDelay
+	}
+	if s.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(s.jitter)))
+	}
+	return delay
+}
+
+// echo writes the messages to out by the schedule, sleep pauses after every burst
+func (s schedule) echo(out io.Writer, text []string, sleep func(time.Duration)) {
+	echoed := 0
+	// with nothing to echo the loop would spin without ever pausing
+	for repetition := 0; len(text) > 0 && (s.repetitions == 0 || repetition < s.repetitions); repetition++ {
+		for i, line := range text {
+			// a single write, so the lines of a multi-line message reach the container log back to back
+			fmt.Fprintln(out, line)
+			echoed++
+			if echoed%s.burst == 0 {
+				sleep(s.pause(i))
+			}
+		}
+	}
+}
+
+// readMessages reads a JSON array of messages, strings are echoed as they are and
+// objects are serialized as single-line JSON. The trailing newline of a multi-line string is dropped.
+func readMessages(file *os.File) ([]string, error) {
+	var messages []json.RawMessage
+	if err := json.NewDecoder(file).Decode(&messages); err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(messages))
+	for i, message := range messages {
+		var line string
+		if err := json.Unmarshal(message, &line); err == nil {
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+			continue
+		}
+		if trimmed := bytes.TrimSpace(message); len(trimmed) == 0 || trimmed[0] != '{' {
+			return nil, fmt.Errorf("message #%d is neither a string nor an object", i)
+		}
+		compacted := new(bytes.Buffer)
+		if err := json.Compact(compacted, message); err != nil {
+			return nil, err
 		}
+		lines = append(lines, compacted.String())
 	}
+	return lines, nil
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadMessages(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		messages string
+		want     []string
+		err      bool
+	}{
+		{
+			name:     "strings and objects",
+			messages: `["plain", {"level": "info",  "nested": {"a": 1}}]`,
+			want:     []string{"plain", `{"level":"info","nested":{"a":1}}`},
+		},
+		{
+			name:     "multi-line string",
+			messages: `["Exception in thread \"main\"\n\tat Main.main(Main.java:3)\n"]`,
+			want:     []string{"Exception in thread \"main\"\n\tat Main.main(Main.java:3)"},
+		},
+		{
+			name:     "number",
+			messages: `["plain", 42]`,
+			err:      true,
+		},
+		{
+			name:     "not an array",
+			messages: `{"level": "info"}`,
+			err:      true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "messages.json")
+			if err := os.WriteFile(path, []byte(tc.messages), 0600); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			got, err := readMessages(file)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected an error %v, got %v", tc.err, err)
+			}
+			if !tc.err && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestScheduleEcho(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		schedule schedule
+		text     []string
+		output   string
+		sleeps   []time.Duration
+	}{
+		{
+			name:     "message delays",
+			schedule: schedule{delay: 3 * time.Second, delays: messageDelays{1: time.Second}, burst: 1, repetitions: 1},
+			text:     []string{"a", "b", "c"},
+			output:   "a\nb\nc\n",
+			sleeps:   []time.Duration{3 * time.Second, time.Second, 3 * time.Second},
+		},
+		{
+			name:     "multi-line message",
+			schedule: schedule{delay: 3 * time.Second, burst: 1, repetitions: 1},
+			text:     []string{"Exception\n\tat Main.main", "after"},
+			output:   "Exception\n\tat Main.main\nafter\n",
+			sleeps:   []time.Duration{3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:     "repetitions",
+			schedule: schedule{delay: time.Second, burst: 1, repetitions: 2},
+			text:     []string{"a", "b"},
+			output:   "a\nb\na\nb\n",
+			sleeps:   []time.Duration{time.Second, time.Second, time.Second, time.Second},
+		},
+		{
+			name:     "bursts",
+			schedule: schedule{delay: time.Second, burst: 2, repetitions: 2},
+			text:     []string{"a", "b", "c"},
+			output:   "a\nb\nc\na\nb\nc\n",
+			sleeps:   []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name:     "rate replaces the delays",
+			schedule: schedule{delay: time.Second, delays: messageDelays{0: time.Minute}, rate: 4, burst: 2, repetitions: 1},
+			text:     []string{"a", "b", "c", "d"},
+			output:   "a\nb\nc\nd\n",
+			sleeps:   []time.Duration{500 * time.Millisecond, 500 * time.Millisecond},
+		},
+		{
+			name:     "nothing to echo",
+			schedule: schedule{delay: 3 * time.Second, burst: 1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			var sleeps []time.Duration
+			tc.schedule.echo(&out, tc.text, func(d time.Duration) { sleeps = append(sleeps, d) })
+
+			if out.String() != tc.output {
+				t.Errorf("expected the output %q, got %q", tc.output, out.String())
+			}
+			if !reflect.DeepEqual(sleeps, tc.sleeps) {
+				t.Errorf("expected the pauses %v, got %v", tc.sleeps, sleeps)
+			}
+		})
+	}
+}
+
+func TestSchedulePauseJitter(t *testing.T) {
+	emission := schedule{delay: time.Second, burst: 1, jitter: 100 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if pause := emission.pause(0); pause < time.Second || pause >= time.Second+100*time.Millisecond {
+			t.Fatalf("expected a pause within the jitter, got %s", pause)
+		}
+	}
+}
@@ -3,6 +3,19 @@ import * as React from 'react';
 import { TextareaAutosize } from '@material-ui/core';
 import { getLastNlogs } from '../utils/flowtests/createFlowTest';
 
+// lines holding a JSON object are sent as objects, the simulator logs them as single-line JSON again
+const toMessage = (line) => {
+  try {
+    const message = JSON.parse(line);
+    if (message && typeof message === 'object' && !Array.isArray(message)) {
+      return message;
+    }
+  } catch (e) {
+    // not JSON, sent as it is
+  }
+  return line;
+};
+
 const ParseTextarea = ({
   onChange, pod, namespace, nLines, required,
 }) => {
@@ -14,7 +27,7 @@ const ParseTextarea = ({
     }
     const logs = await getLastNlogs(pod, namespace, nLines);
     setText(logs);
-    onChange(logs.split('\n'));
+    onChange(logs.split('\n').map(toMessage));
   }, [pod, namespace]);
 
   const handleChange = (e) => {
@@ -22,7 +35,7 @@ const ParseTextarea = ({
     setText(newValue);
     // Remove the last line if it's empty
     // eslint-disable-next-line no-shadow
-    onChange(newValue.split('\n').filter((e) => e));
+    onChange(newValue.split('\n').filter((e) => e).map(toMessage));
   };
 
   return <TextareaAutosize onChange={handleChange} value={text} style={{ height: '180px', width: '750px' }} required={required} />;
@@ -3,8 +3,17 @@ import * as React from 'react';
 import { Grid } from '@material-ui/core';
 import YAML from 'json-to-pretty-yaml';
 
+const badge = (passing, outcome) => {
+  if (outcome) {
+    return <div className="badge-wrapper"><span className={`badge ${outcome.outcome === 'Selected' ? 'badge-pass' : 'badge-fail'}`} title={outcome.message}>{outcome.outcome}</span></div>;
+  }
+  return passing
+    ? <div className="badge-wrapper"><span className="badge badge-pass">Pass</span></div>
+    : <div className="badge-wrapper"><span className="badge badge-fail">Fail</span></div>;
+};
+
 const TestStatus = ({
-  type, tests, status,
+  type, tests, status, outcomes,
 }) => (
   <>
     <div style={{ margin: '10px' }}>
@@ -15,11 +24,7 @@ const TestStatus = ({
         <div>
           {tests?.map((match, index) => (
             <div key={YAML.stringify(match)} style={{ display: 'table' }}>
-              {
-                status[index]
-                  ? <div className="badge-wrapper"><span className="badge badge-pass">Pass</span></div>
-                  : <div className="badge-wrapper"><span className="badge badge-fail">Fail</span></div>
-              }
+              {badge(status[index], outcomes?.[index])}
               <pre style={{ display: 'inline-block', color: status[index] ? 'green' : 'red' }}>
                 { YAML.stringify(match) }
               </pre>
@@ -25,6 +25,8 @@ export default function DetailView() {
         flowTest.spec.referenceFlow.kind,
         flowTest.spec.referenceFlow.name,
       ));
+    } else if (flowTest?.spec?.inlineFlow || flowTest?.spec?.inlineClusterFlow) {
+      setFlow({ spec: flowTest.spec.inlineFlow ?? flowTest.spec.inlineClusterFlow });
     }
   }, [flowTest]);
 
@@ -43,20 +45,183 @@ export default function DetailView() {
               Status:
               {` ${flowTest?.status?.status}`}
             </div>
+            {flowTest?.status?.logging && (
+              <div style={{ margin: '10px' }}>
+                Logging:
+                {` ${flowTest.status.logging}`}
+              </div>
+            )}
+            {flowTest?.status?.pipelineStatus !== undefined && (
+              <div style={{ margin: '10px' }}>
+                Full Pipeline:
+                {flowTest.status.pipelineStatus
+                  ? <div className="badge-wrapper"><span className="badge badge-pass">Pass</span></div>
+                  : <div className="badge-wrapper"><span className="badge badge-fail">Fail</span></div>}
+              </div>
+            )}
             <div style={{ margin: '10px' }}>Reference Flow</div>
             <div style={{ marginLeft: '30px' }}>
               <div>{`Kind: ${flowTest?.spec?.referenceFlow?.kind}`}</div>
               <div>{`Namespace: ${flowTest?.spec?.referenceFlow?.namespace}`}</div>
               <div>{`Name: ${flowTest?.spec?.referenceFlow?.name}`}</div>
             </div>
+            {flowTest?.status?.referenceFlows?.map((referenceFlow) => (
+              <div key={`${referenceFlow.kind}/${referenceFlow.namespace}/${referenceFlow.name}`}>
+                <div style={{ margin: '10px' }}>{`${referenceFlow.kind} ${referenceFlow.namespace}.${referenceFlow.name}`}</div>
+                <div style={{ marginLeft: '30px' }}>
+                  <div>
+                    {'Matches: '}
+                    {referenceFlow.matchStatus?.map((passing, i) => (
+                      // eslint-disable-next-line react/no-array-index-key
+                      <span key={i} className={`badge ${passing ? 'badge-pass' : 'badge-fail'}`}>{`#${i}`}</span>
+                    ))}
+                  </div>
+                  <div>
+                    {'Filters: '}
+                    {referenceFlow.filterStatus?.map((passing, i) => (
+                      // eslint-disable-next-line react/no-array-index-key
+                      <span key={i} className={`badge ${passing ? 'badge-pass' : 'badge-fail'}`}>{`#${i}`}</span>
+                    ))}
+                  </div>
+                  {referenceFlow.pipelineStatus !== undefined && (
+                    <div>
+                      {'Full Pipeline: '}
+                      <span className={`badge ${referenceFlow.pipelineStatus ? 'badge-pass' : 'badge-fail'}`}>
+                        {referenceFlow.pipelineStatus ? 'Pass' : 'Fail'}
+                      </span>
+                    </div>
+                  )}
+                </div>
+              </div>
+            ))}
             <div style={{ margin: '10px' }}>Reference Pod</div>
             <div style={{ marginLeft: '30px' }}>
               <div>{`Namespace: ${flowTest?.spec?.referencePod?.namespace}`}</div>
               <div>{`Name: ${flowTest?.spec?.referencePod?.name}`}</div>
             </div>
+            {flowTest?.status?.destinationHealth && (
+              <>
+                <div style={{ margin: '10px' }}>Destination Health</div>
+                <div style={{ marginLeft: '30px' }}>
+                  {flowTest.status.destinationHealth.map((destination) => (
+                    <div key={`${destination.kind}/${destination.namespace}/${destination.name}`}>
+                      {`${destination.kind} ${destination.namespace}.${destination.name}: `}
+                      {destination.found && destination.active && !destination.problemsCount
+                        ? <span className="badge badge-pass">Healthy</span>
+                        : <span className="badge badge-fail">Unhealthy</span>}
+                      {destination.message && <div>{destination.message}</div>}
+                      {destination.problems?.map((problem) => <pre key={problem}>{problem}</pre>)}
+                    </div>
+                  ))}
+                </div>
+              </>
+            )}
+            {flowTest?.status?.slices?.some((slice) => slice.outcome === 'ConfigRejected') && (
+              <>
+                <div style={{ margin: '10px' }}>Rejected Slices</div>
+                <div style={{ marginLeft: '30px' }}>
+                  {flowTest.status.slices.filter((slice) => slice.outcome === 'ConfigRejected').map((slice) => (
+                    <div key={slice.name}>
+                      {`${slice.type} #${slice.testId}: `}
+                      <span className="badge badge-fail">Config Rejected</span>
+                      {slice.message && <pre>{slice.message}</pre>}
+                    </div>
+                  ))}
+                </div>
+              </>
+            )}
+            {flowTest?.status?.slices?.some((slice) => slice.rejectedWrites > 0) && (
+              <>
+                <div style={{ margin: '10px' }}>Rejected Writes</div>
+                <div style={{ marginLeft: '30px' }}>
+                  {flowTest.status.slices.filter((slice) => slice.rejectedWrites > 0).map((slice) => (
+                    <div key={slice.name}>
+                      {`${slice.type} #${slice.testId}: `}
+                      <span className="badge badge-fail">{`${slice.rejectedWrites} unauthenticated`}</span>
+                    </div>
+                  ))}
+                </div>
+              </>
+            )}
+            {flowTest?.status?.slices?.some((slice) => slice.truncated) && (
+              <>
+                <div style={{ margin: '10px' }}>Truncated Slices</div>
+                <div style={{ marginLeft: '30px' }}>
+                  {flowTest.status.slices.filter((slice) => slice.truncated).map((slice) => (
+                    <div key={slice.name}>
+                      {`${slice.type} #${slice.testId}: `}
+                      <span className="badge badge-warning">{`${slice.droppedRecords || 0} dropped, ${slice.evictedRecords || 0} evicted`}</span>
+                      {' the sample is partial'}
+                    </div>
+                  ))}
+                </div>
+              </>
+            )}
+            {flowTest?.status?.slices?.some((slice) => slice.faults) && (
+              <>
+                <div style={{ margin: '10px' }}>Injected Faults</div>
+                <div style={{ marginLeft: '30px' }}>
+                  {flowTest.status.slices.filter((slice) => slice.faults).map((slice) => (
+                    <div key={slice.name}>
+                      {`${slice.type} #${slice.testId}: `}
+                      {slice.faults.arrived
+                        ? <span className="badge badge-pass">Arrived</span>
+                        : <span className="badge badge-fail">Not Arrived</span>}
+                      {` ${slice.faults.faultedWrites} faulted writes`}
+                      {slice.faults.lateness && `, ${slice.faults.lateness} late`}
+                      {slice.faults.discardedRecords > 0 && `, ${slice.faults.discardedRecords} discarded`}
+                      {slice.faults.duplicateRecords > 0 && `, ${slice.faults.duplicateRecords} duplicated`}
+                    </div>
+                  ))}
+                </div>
+              </>
+            )}
+            {flowTest?.status?.unreproducedMetadata && (
+              <>
+                <div style={{ margin: '10px' }}>Unreproduced Metadata</div>
+                <div style={{ marginLeft: '30px' }}>
+                  {flowTest.status.unreproducedMetadata.map((metadata) => (
+                    <div key={`${metadata.field}/${metadata.reason}`}>{`${metadata.field}: ${metadata.reason}`}</div>
+                  ))}
+                </div>
+              </>
+            )}
+            {flowTest?.status?.comparison?.messages && (
+              <>
+                <div style={{ margin: '10px' }}>Baseline vs Candidate</div>
+                <div style={{ marginLeft: '30px' }}>
+                  {flowTest.status.comparison.messages.map((message, i) => (
+                    // eslint-disable-next-line react/no-array-index-key
+                    <div key={i}>
+                      <pre>{message.message}</pre>
+                      {message.deliveryChanged || message.recordChanged
+                        ? <span className="badge badge-fail">Changed</span>
+                        : <span className="badge badge-pass">Unchanged</span>}
+                      {message.diff && <pre>{message.diff}</pre>}
+                    </div>
+                  ))}
+                </div>
+              </>
+            )}
+            {flowTest?.status?.slices?.some((slice) => slice.sample) && (
+              <>
+                <div style={{ margin: '10px' }}>Output Records</div>
+                <div style={{ marginLeft: '30px' }}>
+                  {flowTest.status.slices.filter((slice) => slice.sample).map((slice) => (
+                    <div key={slice.name}>
+                      {`${slice.type} #${slice.testId}`}
+                      {slice.sample.map((record, i) => (
+                        // eslint-disable-next-line react/no-array-index-key
+                        <pre key={i}>{record}</pre>
+                      ))}
+                    </div>
+                  ))}
+                </div>
+              </>
+            )}
             <div style={{ margin: '10px' }}>Testing Logs</div>
             <div style={{ marginLeft: '30px' }}>
-              {flowTest?.spec?.sentMessages?.map((message) => (
+              {flowTest?.spec?.sentMessages?.map((message) => (typeof message === 'string' ? message : JSON.stringify(message))).map((message) => (
                 <pre key={message}>
                   { message }
                 </pre>
@@ -64,8 +229,17 @@ export default function DetailView() {
             </div>
           </Grid>
           <Grid item xs={12} xl={6}>
-            <TestStatus type="Matches" tests={flow?.spec?.match} status={flowTest?.status?.matchStatus} />
-            <TestStatus type="Filters" tests={flow?.spec?.filters} status={flowTest?.status?.filterStatus} />
+            <TestStatus type="Matches" tests={flow?.spec?.match} status={flowTest?.status?.matchStatus} outcomes={flowTest?.status?.matchResults} />
+            <Grid container>
+              <Grid item xs={flowTest?.status?.isolatedFilterStatus ? 6 : 12}>
+                <TestStatus type="Filters" tests={flow?.spec?.filters} status={flowTest?.status?.filterStatus} />
+              </Grid>
+              {flowTest?.status?.isolatedFilterStatus && (
+                <Grid item xs={6}>
+                  <TestStatus type="Filters (isolated)" tests={flow?.spec?.filters} status={flowTest?.status?.isolatedFilterStatus} />
+                </Grid>
+              )}
+            </Grid>
           </Grid>
         </Grid>
       </Paper>
@@ -18,9 +18,10 @@ export default async function getFlowTests() {
         namespace: flowTest.metadata.namespace,
         status: flowTest.status.status,
         name: flowTest.metadata.name,
-        flowType: flowTest.spec.referenceFlow.kind,
+        flowType: (flowTest.spec.referenceFlow ?? flowTest.spec.referenceFlows?.[0])?.kind,
         referencePod: flowTest.spec.referencePod.name,
-        referenceFlow: flowTest.spec.referenceFlow.name,
+        referenceFlow: [flowTest.spec.referenceFlow, ...(flowTest.spec.referenceFlows ?? [])]
+          .filter((referenceFlow) => referenceFlow).map((referenceFlow) => referenceFlow.name).join(', '),
         totalTests,
         passedTests,
         failedTests: totalTests - passedTests,
@@ -14,7 +14,9 @@ const schema = yup.object().shape({
       namespace: yup.string().required('Flow namespace is required'),
       name: yup.string().required('Flow name is required'),
     }),
-    sentMessages: yup.array().of(yup.string()).required('FlowTest must have at least one message'),
+    sentMessages: yup.array().of(
+      yup.mixed().test('message', 'Messages must be strings or objects', (message) => typeof message === 'string' || (typeof message === 'object' && message !== null && !Array.isArray(message))),
+    ).required('FlowTest must have at least one message'),
   }),
 });
 